@@ -31,7 +31,7 @@ var rootCmd = &cobra.Command{
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		var version string
-		err := mysql.DB.Get(&version, "SELECT @@version")
+		err := mysql.DB().Get(&version, "SELECT @@version")
 		if err != nil {
 			panic(err)
 		}
@@ -46,8 +46,10 @@ func init() {
 	}
 }
 
+// Execute runs the root command, it exits with status 1 if the command fails so that scripts and go generate notice it
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestExecuteExitStatus runs config check in a child process, a failing check must exit with a non-zero status
+func TestExecuteExitStatus(t *testing.T) {
+	if args := os.Getenv("GOOEY_EXECUTE_ARGS"); args != "" {
+		os.Args = append([]string{"gooey"}, strings.Fields(args)...)
+		Execute()
+		return
+	}
+
+	// the config file is searched in the etc directory of the working directory first
+	dir := t.TempDir()
+	err := os.Mkdir(filepath.Join(dir, "etc"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "etc", "default.yaml"), []byte("settings:\n  log:\n    level: [debug]\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	executable, err := filepath.Abs(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(args string) (string, error) {
+		c := exec.Command(executable, "-test.run=^TestExecuteExitStatus$")
+		c.Dir = dir
+		c.Env = append(os.Environ(), "GOOEY_EXECUTE_ARGS="+args, "XDG_CONFIG_HOME="+dir)
+		out, err := c.CombinedOutput()
+		return string(out), err
+	}
+
+	out, err := run("config check")
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("got %v, want exit status 1, output:\n%s", err, out)
+	}
+	if !strings.Contains(out, "settings.log.level") {
+		t.Errorf("the error is not printed:\n%s", out)
+	}
+
+	// the embedded default config file passes
+	out, err = run("config check --embedded")
+	if err != nil {
+		t.Fatalf("checking the embedded config failed: %v, output:\n%s", err, out)
+	}
+}
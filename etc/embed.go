@@ -0,0 +1,9 @@
+package etc
+
+import "embed"
+
+// FS holds the default configuration embedded into the binary, it is validated against the module schema by go generate
+//
+//go:generate go run .. config check --embedded
+//go:embed default.yaml
+var FS embed.FS
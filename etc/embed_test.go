@@ -0,0 +1,49 @@
+package etc_test
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/vvfock3r/gooey/etc"
+	"github.com/vvfock3r/gooey/kernel/load"
+)
+
+// TestDefault validates the embedded default config against the schema of the built-in modules
+func TestDefault(t *testing.T) {
+	root := &cobra.Command{Use: "gooey", SilenceUsage: true}
+	for _, m := range load.ModuleList {
+		m.Register(root)
+	}
+	root.SetArgs([]string{"config", "check", "--embedded"})
+	err := root.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestDefaultSecrets checks that no secret is embedded into the binary
+func TestDefaultSecrets(t *testing.T) {
+	data, err := fs.ReadFile(etc.FS, "default.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var settings struct {
+		Settings struct {
+			Databases struct {
+				Default struct {
+					Password string `yaml:"password"`
+				} `yaml:"default"`
+			} `yaml:"databases"`
+		} `yaml:"settings"`
+	}
+	err = yaml.Unmarshal(data, &settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.Settings.Databases.Default.Password != "" {
+		t.Error("settings.databases.default.password must be empty in the embedded default config")
+	}
+}
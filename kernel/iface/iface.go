@@ -1,9 +1,43 @@
 package iface
 
-import "github.com/spf13/cobra"
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/vvfock3r/gooey/kernel/snapshot"
+)
 
 type Module interface {
 	Register(*cobra.Command)
 	MustCheck(*cobra.Command)
 	Initialize(*cobra.Command) error
 }
+
+// Scoped is implemented by modules that only depend on part of the configuration,
+// a reload reinitializes them only when a key under one of the prefixes changed,
+// an empty prefix matches every key
+type Scoped interface {
+	Prefixes() []string
+}
+
+// Preparer is implemented by modules supporting transactional reloads,
+// Prepare builds the new state of the module from s without applying it,
+// the modules are prepared and then committed in the order of the module list, which is the dependency order,
+// a module is committed after the modules it depends on, their new state is not visible yet in Prepare
+type Preparer interface {
+	Prepare(cmd *cobra.Command, s *snapshot.Snapshot) (Prepared, error)
+}
+
+// Prepared is a module state built by Prepare, it is committed only if every affected module
+// prepared successfully, otherwise it is discarded and the previous snapshot stays active
+type Prepared interface {
+	Commit()
+	Discard()
+}
+
+// Reloadable is implemented by modules applying configuration changes at runtime,
+// the watch module reloads the instances of the module list implementing it
+type Reloadable interface {
+	Module
+	Scoped
+	Preparer
+}
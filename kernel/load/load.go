@@ -1,8 +1,12 @@
 package load
 
 import (
+	"time"
+
+	"github.com/vvfock3r/gooey/etc"
 	"github.com/vvfock3r/gooey/kernel/iface"
 	"github.com/vvfock3r/gooey/kernel/module/config"
+	"github.com/vvfock3r/gooey/kernel/module/control"
 	"github.com/vvfock3r/gooey/kernel/module/help"
 	"github.com/vvfock3r/gooey/kernel/module/logger"
 	"github.com/vvfock3r/gooey/kernel/module/maxprocs"
@@ -24,22 +28,46 @@ var ModuleList = []iface.Module{
 	},
 	&config.Config{
 		AddFlag:   false,
-		Name:      "etc/default",
-		Exts:      []string{"yaml"},
-		Path:      []string{".", "$HOME", "/etc"},
+		AppName:   "gooey",
+		Name:      "default",
+		Exts:      []string{"yaml", "yml", "toml", "json", "hcl", "env"},
+		Merge:     false,
 		MustExist: false,
+		Embed:     etc.FS,
+		EmbedName: "default.yaml",
+		Remote: config.Remote{
+			URL:       "${GOOEY_CONFIG_URL}",
+			Token:     "${GOOEY_CONFIG_TOKEN}",
+			PublicKey: "${GOOEY_CONFIG_PUBLIC_KEY}",
+			Interval:  30 * time.Second,
+		},
 	},
 
 	// 具有依赖关系的模块,详情可以查看模块的import部分
 	&logger.Logger{
 		AddFlag:   false,
 		AddCaller: true,
+		// debug level toggled by SIGUSR2 is restored after 30 minutes
+		LevelSignalTTL: 30 * time.Minute,
+	},
+	&control.Control{
+		AddFlag:         true,
+		AllowedCommands: []string{"gooey"},
+		AppName:         "gooey",
 	},
 	&maxprocs.AutoMaxProcs{},
-	&watch.Watch{
-		List: []iface.Module{&logger.Logger{AddCaller: true}}},
+	&watch.Watch{},
 	&mysql.MySQL{
 		AddFlag:         true,
 		AllowedCommands: []string{"gooey"},
 	},
 }
+
+func init() {
+	// watch reloads the modules of the list implementing iface.Reloadable
+	for _, m := range ModuleList {
+		if w, ok := m.(*watch.Watch); ok {
+			w.List = ModuleList
+		}
+	}
+}
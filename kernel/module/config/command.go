@@ -0,0 +1,206 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vvfock3r/gooey/kernel/schema"
+)
+
+// command returns the config command and its subcommands
+func (c *Config) command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage configuration file",
+		// config subcommands must work without a valid configuration, skip the module initialization
+		PersistentPreRunE: func(*cobra.Command, []string) error { return nil },
+	}
+	cmd.AddCommand(c.initCommand())
+	cmd.AddCommand(c.convertCommand())
+	cmd.AddCommand(c.migrateCommand())
+	cmd.AddCommand(c.showCommand())
+	cmd.AddCommand(c.checkCommand())
+	return cmd
+}
+
+func (c *Config) initCommand() *cobra.Command {
+	var (
+		lang   string
+		output string
+		force  bool
+	)
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Generate a commented configuration file from the registered module defaults",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			content, err := schema.Render(lang)
+			if err != nil {
+				return err
+			}
+
+			// the file is readable only by the owner when it contains secrets
+			perm := fs.FileMode(0644)
+			if schema.HasSecrets() {
+				perm = 0600
+			}
+
+			if output != "" {
+				err = writeConverted(output, content, perm, force)
+				if err != nil {
+					return err
+				}
+				fmt.Println(output)
+				return nil
+			}
+
+			paths := c.searchPaths()
+			for _, path := range paths {
+				name := filepath.Join(path, c.Name+"."+c.Exts[0])
+				err = writeConverted(name, content, perm, force)
+				if errors.Is(err, fs.ErrPermission) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				fmt.Println(name)
+				return nil
+			}
+			return fmt.Errorf("no writable search path found in %v", paths)
+		},
+	}
+	cmd.Flags().StringVar(&lang, "lang", schema.DefaultLang, "language of the comments, such as zh or en")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "output file, the format is detected by the extension, defaults to the first writable search path")
+	cmd.Flags().BoolVar(&force, "force", false, "overwrite the file if it already exists")
+	return cmd
+}
+
+func (c *Config) convertCommand() *cobra.Command {
+	var (
+		from  string
+		to    string
+		force bool
+	)
+	cmd := &cobra.Command{
+		Use:   "convert <input> <output>",
+		Short: "Convert a configuration file between yaml, json, toml, hcl and dotenv",
+		Long: "Convert a configuration file between yaml, json, toml, hcl and dotenv\n" +
+			"Formats are detected by the file extension, use - for stdin or stdout together with --from or --to\n" +
+			"Comments are kept when converting from yaml to any format except json\n" +
+			"Dotenv values are strings, the types of the registered keys are restored when reading them back, " +
+			"unknown keys, lists of mappings and map keys cannot be converted to dotenv, empty mappings and lists are dropped",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			input, output := args[0], args[1]
+
+			fromFormat, err := detectFormat(input, from)
+			if err != nil {
+				return err
+			}
+			toFormat, err := detectFormat(output, to)
+			if err != nil {
+				return err
+			}
+
+			var data []byte
+			perm := fs.FileMode(0644)
+			if input == stdin {
+				data, err = io.ReadAll(os.Stdin)
+			} else {
+				data, err = os.ReadFile(input)
+				if info, statErr := os.Stat(input); statErr == nil {
+					perm = info.Mode().Perm()
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+			doc, err := parse(data, fromFormat)
+			if err != nil {
+				return fmt.Errorf("%s: %w", input, err)
+			}
+			content, err := encode(doc, toFormat)
+			if err != nil {
+				return err
+			}
+
+			if output == stdin {
+				_, err = os.Stdout.Write(content)
+				return err
+			}
+			return writeFile(output, content, perm, force)
+		},
+	}
+	cmd.Flags().StringVar(&from, "from", "", "input format, detected by the extension if empty")
+	cmd.Flags().StringVar(&to, "to", "", "output format, detected by the extension if empty")
+	cmd.Flags().BoolVar(&force, "force", false, "overwrite the output file if it already exists")
+	return cmd
+}
+
+// detectFormat returns the format given by flag, or detects it by the file extension
+func detectFormat(file string, flag string) (string, error) {
+	if flag != "" {
+		return normalizeFormat(flag)
+	}
+	if file == stdin {
+		return "", fmt.Errorf("the format of stdin or stdout must be specified by --from or --to")
+	}
+	return formatOf(file)
+}
+
+// writeConverted writes YAML content in the format of the file extension
+func writeConverted(name string, content []byte, perm fs.FileMode, force bool) error {
+	format, err := formatOf(name)
+	if err != nil {
+		return err
+	}
+	if format != "yaml" {
+		doc, err := parse(content, "yaml")
+		if err != nil {
+			return err
+		}
+		content, err = encode(doc, format)
+		if err != nil {
+			return err
+		}
+	}
+	return writeFile(name, content, perm, force)
+}
+
+func writeFile(name string, content []byte, perm fs.FileMode, force bool) error {
+	err := os.MkdirAll(filepath.Dir(name), 0755)
+	if err != nil {
+		return err
+	}
+
+	flag := os.O_CREATE | os.O_WRONLY | os.O_EXCL
+	if force {
+		flag = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	}
+	file, err := os.OpenFile(name, flag, perm)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("file already exists: %s, use --force to overwrite", name)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(content)
+	if err1 := file.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return err
+	}
+
+	// OpenFile does not change the mode of an existing file
+	return os.Chmod(name, perm)
+}
@@ -1,42 +1,97 @@
 package config
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"sync"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"github.com/vvfock3r/gooey/kernel/module/logger"
+	"github.com/vvfock3r/gooey/kernel/schema"
+	"github.com/vvfock3r/gooey/kernel/snapshot"
 )
 
+// stdin is the config file name that reads the configuration from standard input
+const stdin = "-"
+
+var errNotFound = errors.New("config file not found")
+
+// source is the configuration currently loaded into viper
+var source struct {
+	sync.Mutex
+	loaded
+}
+
+// loaded is the result of reading the config files, names are the config files found by
+// the search, highest priority first, files are all files read including the included ones,
+// files[0] is the main file, content is what viper reads
+type loaded struct {
+	names         []string
+	format        string
+	files         []loadedFile
+	content       []byte
+	contentFormat string
+	settings      map[string]any
+}
+
+// loadedFile is a configuration file read from disk or stdin
+type loadedFile struct {
+	name     string
+	format   string
+	data     []byte
+	moves    []schema.Deprecation
+	migrated bool
+}
+
 // Config implement the Module interface
 type Config struct {
-	flag      string
-	AddFlag   bool
-	Name      string
-	Exts      []string
-	Path      []string
-	MustExist bool
+	flag       string
+	formatFlag string
+	AddFlag    bool
+	Name       string
+	Exts       []string
+	Path       []string
+	AppName    string
+	Merge      bool
+	MustExist  bool
+	Embed      fs.FS
+	EmbedName  string
+	Remote     Remote
 }
 
 func (c *Config) Register(cmd *cobra.Command) {
 	// register flag -c / --config
 	if c.AddFlag {
-		cmd.PersistentFlags().StringVarP(&c.flag, "config", "c", "", "config file")
+		cmd.PersistentFlags().StringVarP(&c.flag, "config", "c", "", "config file or http(s) URL, - reads from stdin")
+		cmd.PersistentFlags().StringVar(&c.formatFlag, "config-format", "", "config format, detected by the file extension if empty")
 	}
 
-	// supported config extensions
-	viper.SupportedExts = c.Exts
+	// register command config
+	cmd.AddCommand(c.command())
 
-	// search config file
-	viper.SetConfigName(c.Name)
-	for _, path := range c.Path {
-		viper.AddConfigPath(path)
-	}
+	// declare keys handled by the config module
+	schema.Register(keys...)
 }
 
 func (c *Config) MustCheck(*cobra.Command) {
+	// reading from stdin requires an explicit format
+	if c.flag == stdin && c.formatFlag == "" {
+		fmt.Printf("--config-format is required when reading config from stdin\n")
+		os.Exit(1)
+	}
+
 	// if -c / --config is specified, the file must exist
-	if c.flag != "" {
+	if c.flag != "" && isLocal(c.flag) {
 		_, err := os.Stat(c.flag)
 		if err != nil && os.IsNotExist(err) {
 			fmt.Printf("cannot find the file: %s\n", c.flag)
@@ -46,18 +101,291 @@ func (c *Config) MustCheck(*cobra.Command) {
 }
 
 func (c *Config) Initialize(*cobra.Command) error {
+	// embedded default configuration
+	err := c.loadEmbedded()
+	if err != nil {
+		return err
+	}
+
+	// search configuration, a remote source replaces the local files
+	names := []string{c.flag}
+	c.Remote.URL = os.ExpandEnv(c.Remote.URL)
+	switch {
+	case isURL(c.flag) || c.flag == "" && c.Remote.URL != "":
+		if isURL(c.flag) {
+			c.Remote.URL = c.flag
+		}
+		err = c.Remote.load(context.Background())
+		if err != nil {
+			return err
+		}
+		remote = &c.Remote
+		names = []string{c.Remote.URL}
+	case c.flag == "":
+		names, err = c.find()
+		// the logger is initialized after the config module, the debug level is only known then
+		lines := Trace()
+		logger.AfterInitialize(func() {
+			for _, line := range lines {
+				log().Debug("config search", zap.String("detail", line))
+			}
+		})
+		if err != nil {
+			// if MustExist is set to false, ignore errNotFound
+			if !errors.Is(err, errNotFound) || c.MustExist {
+				return err
+			}
+		}
+	}
+
 	// read configuration
-	viper.SetConfigFile(c.flag)
-	err := viper.ReadInConfig()
-	if err == nil {
-		return nil
+	if len(names) > 0 {
+		err = read(names, c.formatFlag)
+		if err != nil {
+			return err
+		}
+	}
+
+	s, err := Load()
+	if err != nil {
+		return err
+	}
+	snapshot.Store(s)
+	return nil
+}
+
+// read loads config files into viper, names are ordered from the highest priority,
+// format is detected by the file extension if empty
+func read(names []string, format string) error {
+	var (
+		settings = make(map[string]any)
+		files    []loadedFile
+	)
+	for i := len(names) - 1; i >= 0; i-- {
+		name := names[i]
+
+		var (
+			data []byte
+			err  error
+		)
+		fileFormat := format
+		switch {
+		case name == stdin:
+			data, err = io.ReadAll(os.Stdin)
+		case isURL(name):
+			var detected string
+			data, detected = remote.content()
+			if fileFormat == "" {
+				fileFormat = detected
+			}
+		default:
+			data, err = os.ReadFile(name)
+		}
+		if err != nil {
+			return err
+		}
+
+		if fileFormat == "" {
+			fileFormat, err = formatOf(name)
+		} else {
+			fileFormat, err = normalizeFormat(fileFormat)
+		}
+		if err != nil {
+			return err
+		}
+
+		// merge the included files beneath the including file
+		sub, subFiles, err := resolve(loadedFile{name: name, format: fileFormat, data: data}, nil)
+		if err != nil {
+			return err
+		}
+		mergeMaps(settings, sub)
+		files = append(subFiles, files...)
+	}
+
+	// dotenv keys are flat, hcl blocks are lists, migrated keys are renamed and merged files
+	// are combined, load the normalized settings instead
+	l := loaded{names: names, format: format, files: files, settings: settings}
+	main := files[0]
+	l.content, l.contentFormat = main.data, main.format
+	if len(names) > 1 || main.format == "dotenv" || main.format == "hcl" || main.migrated {
+		var err error
+		l.content, err = yaml.Marshal(settings)
+		if err != nil {
+			return err
+		}
+		l.contentFormat = "yaml"
+	}
+	return apply(l)
+}
+
+// apply loads the configuration read by read into viper
+func apply(l loaded) error {
+	source.Lock()
+	defer source.Unlock()
+
+	main := l.files[0]
+	viper.SetConfigType(l.contentFormat)
+	err := viper.ReadConfig(bytes.NewReader(l.content))
+	if err != nil {
+		return fmt.Errorf("%s: %w", main.name, err)
+	}
+	if len(l.files) > 1 {
+		err = viper.MergeConfigMap(l.settings)
+		if err != nil {
+			return err
+		}
 	}
+	if isLocal(main.name) {
+		viper.SetConfigFile(main.name)
+	}
+
+	source.loaded = l
+	return nil
+}
 
-	// if MustExist is set to false, ignore ConfigFileNotFoundError
-	_, ok := err.(viper.ConfigFileNotFoundError)
-	if ok && !c.MustExist {
+// Reread reads the current config files again, a remote source is fetched again,
+// the configuration read from stdin is kept as is
+func Reread() error {
+	source.Lock()
+	names, format := source.names, source.format
+	source.Unlock()
+
+	if len(names) == 0 || names[0] == stdin {
 		return nil
 	}
+	if isURL(names[0]) {
+		// answered with 304 Not Modified if the polling already fetched the content
+		_, err := remote.Fetch(context.Background())
+		if err != nil {
+			return err
+		}
+	}
+	return read(names, format)
+}
+
+// Reload reads the config files again and builds a validated snapshot without storing it,
+// rollback restores the previous configuration in viper if the reload is abandoned
+func Reload() (s *snapshot.Snapshot, rollback func(), err error) {
+	source.Lock()
+	previous := source.loaded
+	source.Unlock()
+
+	rollback = func() {
+		if len(previous.files) > 0 {
+			_ = apply(previous)
+		}
+	}
+	err = Reread()
+	if err == nil {
+		s, err = Load()
+	}
+	if err != nil {
+		rollback()
+		return nil, nil, err
+	}
+	return s, rollback, nil
+}
+
+// Files returns the absolute paths of the main config file followed by the included and merged files,
+// the configuration read from stdin or a remote source is not listed
+func Files() []string {
+	source.Lock()
+	defer source.Unlock()
+
+	var names []string
+	for _, f := range source.files {
+		if !isLocal(f.name) {
+			continue
+		}
+		name, err := filepath.Abs(f.name)
+		if err != nil {
+			name = f.name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// Load resolves the interpolations of the configuration held by viper, validates it
+// and builds a snapshot of it, the snapshot is not stored
+func Load() (*snapshot.Snapshot, error) {
+	settings := viper.AllSettings()
+	err := interpolate(settings)
+	if err != nil {
+		return nil, err
+	}
+	s := snapshot.New(settings)
+
+	doc, err := document()
+	if err != nil {
+		return nil, err
+	}
+	err = schema.Validate(doc, s.Get)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
 
+// Validate checks the loaded configuration against the keys declared by the loaded modules
+func Validate() error {
+	_, err := Load()
 	return err
 }
+
+// document collects the keys present in the config files, with positions if the format allows
+func document() (*schema.Document, error) {
+	source.Lock()
+	files := source.files
+	source.Unlock()
+
+	var doc *schema.Document
+	for _, f := range files {
+		d, err := f.document()
+		if err != nil {
+			return nil, err
+		}
+		if doc == nil {
+			doc = d
+		} else {
+			doc.Merge(d)
+		}
+	}
+	return doc, nil
+}
+
+// document collects the keys present in the file, renamed by the migrations
+func (f *loadedFile) document() (*schema.Document, error) {
+	name := f.name
+	if name == stdin {
+		name = "<stdin>"
+	}
+
+	var (
+		doc *schema.Document
+		err error
+	)
+	if f.format == "yaml" {
+		doc, err = schema.ParseYAML(name, f.data)
+	} else {
+		var settings map[string]any
+		settings, err = decode(f.data, f.format)
+		if err == nil {
+			doc = schema.NewDocument(name, flatten(settings, ""))
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	for _, move := range f.moves {
+		doc.Rename(move.Old, move.New)
+	}
+	return doc, nil
+}
+
+// log returns the logger of the config module, named config in settings.log.levels
+func log() *zap.Logger {
+	return logger.Named("config")
+}
@@ -0,0 +1,226 @@
+package config
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+
+	"github.com/vvfock3r/gooey/kernel/schema"
+	"github.com/vvfock3r/gooey/kernel/snapshot"
+)
+
+// embeddedPrefix marks the name of the embedded config file in messages
+const embeddedPrefix = "embed:"
+
+// readEmbedded reads the embedded default config file, it returns nil if no file is embedded
+func (c *Config) readEmbedded() (*loadedFile, map[string]any, error) {
+	if c.Embed == nil {
+		return nil, nil, nil
+	}
+
+	name := embeddedPrefix + c.EmbedName
+	data, err := fs.ReadFile(c.Embed, c.EmbedName)
+	if err != nil {
+		return nil, nil, err
+	}
+	format, err := formatOf(c.EmbedName)
+	if err != nil {
+		return nil, nil, err
+	}
+	settings, err := decode(data, format)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	tree := &schema.MapTree{Settings: settings}
+	_, err = schema.Migrate(tree)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
+	delete(settings, includeKey)
+
+	return &loadedFile{name: name, format: format, data: data, moves: tree.Moves}, settings, nil
+}
+
+// loadEmbedded sets the embedded default config as the lowest priority layer and validates it
+func (c *Config) loadEmbedded() error {
+	f, settings, err := c.readEmbedded()
+	if f == nil || err != nil {
+		return err
+	}
+
+	for _, key := range flatten(settings, "") {
+		value, _ := lookup(settings, key)
+		viper.SetDefault(key, value)
+	}
+
+	doc, err := f.document()
+	if err != nil {
+		return err
+	}
+	return schema.Validate(doc, viper.Get)
+}
+
+func (c *Config) showCommand() *cobra.Command {
+	var (
+		embedded    bool
+		format      string
+		showSecrets bool
+		showTrace   bool
+	)
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "Print the effective configuration, secrets are redacted",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if embedded {
+				if c.Embed == nil {
+					return fmt.Errorf("no config file is embedded")
+				}
+				data, err := c.showEmbedded(showSecrets)
+				if err != nil {
+					return err
+				}
+				_, err = os.Stdout.Write(data)
+				return err
+			}
+
+			err := c.Initialize(cmd)
+			if showTrace {
+				printTrace()
+			}
+			if err != nil {
+				return err
+			}
+			settings := snapshot.Current().AllSettings()
+			if !showSecrets {
+				redact(settings, "")
+			}
+
+			var doc yaml.Node
+			err = doc.Encode(settings)
+			if err != nil {
+				return err
+			}
+			to, err := normalizeFormat(format)
+			if err != nil {
+				return err
+			}
+			content, err := encode(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&doc}}, to)
+			if err != nil {
+				return err
+			}
+			_, err = os.Stdout.Write(content)
+			return err
+		},
+	}
+	cmd.Flags().BoolVar(&embedded, "embedded", false, "print the embedded default config file, secrets are redacted too")
+	cmd.Flags().StringVar(&format, "format", "yaml", "output format")
+	cmd.Flags().BoolVar(&showSecrets, "show-secrets", false, "print secrets in clear text")
+	cmd.Flags().BoolVar(&showTrace, "trace", false, "print the config file search trace")
+	return cmd
+}
+
+func (c *Config) checkCommand() *cobra.Command {
+	var (
+		embedded  bool
+		showTrace bool
+	)
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Validate the configuration against the module schema",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			if embedded {
+				err = c.loadEmbedded()
+			} else {
+				err = c.Initialize(cmd)
+			}
+			if showTrace {
+				printTrace()
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Println("config ok")
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&embedded, "embedded", false, "only validate the embedded default config file")
+	cmd.Flags().BoolVar(&showTrace, "trace", false, "print the config file search trace")
+	return cmd
+}
+
+// printTrace prints the config file search trace to stderr
+func printTrace() {
+	for _, line := range Trace() {
+		fmt.Fprintf(os.Stderr, "search: %s\n", line)
+	}
+}
+
+// showEmbedded returns the embedded default config file, the values of secret keys are redacted unless secrets is set
+func (c *Config) showEmbedded(secrets bool) ([]byte, error) {
+	data, err := fs.ReadFile(c.Embed, c.EmbedName)
+	if err != nil || secrets {
+		return data, err
+	}
+	format, err := formatOf(c.EmbedName)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parse(data, format)
+	if err != nil {
+		return nil, err
+	}
+	if !redactNode(mapping(doc), "") {
+		return data, nil
+	}
+	return encode(doc, format)
+}
+
+// redactNode replaces the values of secret keys in a YAML mapping node, it reports whether any value was replaced
+func redactNode(n *yaml.Node, prefix string) bool {
+	if n.Kind != yaml.MappingNode {
+		return false
+	}
+	redacted := false
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		name := strings.ToLower(k.Value)
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		if v.Kind == yaml.MappingNode {
+			redacted = redactNode(v, name) || redacted
+			continue
+		}
+		if schema.IsSecret(name) && strings.TrimSpace(v.Value) != "" {
+			v.Kind, v.Tag, v.Style, v.Value, v.Content = yaml.ScalarNode, "!!str", 0, schema.Redacted, nil
+			redacted = true
+		}
+	}
+	return redacted
+}
+
+// redact replaces the values of secret keys
+func redact(settings map[string]any, prefix string) {
+	for k, v := range settings {
+		name := k
+		if prefix != "" {
+			name = prefix + "." + k
+		}
+		if m, ok := v.(map[string]any); ok {
+			redact(m, name)
+			continue
+		}
+		if schema.IsSecret(name) && strings.TrimSpace(fmt.Sprint(v)) != "" {
+			settings[k] = schema.Redacted
+		}
+	}
+}
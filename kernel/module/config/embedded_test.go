@@ -0,0 +1,50 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/vvfock3r/gooey/kernel/schema"
+)
+
+func init() {
+	schema.Register(
+		schema.Key{Name: "settings.embedded.user", Type: schema.String},
+		schema.Key{Name: "settings.embedded.password", Type: schema.String, Secret: true},
+	)
+}
+
+func TestShowEmbedded(t *testing.T) {
+	c := &Config{
+		Embed: fstest.MapFS{"default.yaml": {Data: []byte(`settings:
+  embedded:
+    # the user
+    user: root
+    password: secret # the password
+`)}},
+		EmbedName: "default.yaml",
+	}
+
+	data, err := c.showEmbedded(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(data)
+	if strings.Contains(content, "secret") {
+		t.Errorf("the secret is not redacted:\n%s", content)
+	}
+	for _, want := range []string{"# the user", "user: root", "password: '" + schema.Redacted + "' # the password"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("%q is missing in:\n%s", want, content)
+		}
+	}
+
+	data, err = c.showEmbedded(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "password: secret") {
+		t.Errorf("the secret is redacted with secrets shown:\n%s", data)
+	}
+}
@@ -0,0 +1,499 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+
+	"github.com/vvfock3r/gooey/kernel/schema"
+)
+
+// formats maps file extensions to config formats
+var formats = map[string]string{
+	"yaml":   "yaml",
+	"yml":    "yaml",
+	"json":   "json",
+	"toml":   "toml",
+	"hcl":    "hcl",
+	"tfvars": "hcl",
+	"env":    "dotenv",
+	"dotenv": "dotenv",
+}
+
+// formatOf detects the format of a file by its extension
+func formatOf(file string) (string, error) {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(file), "."))
+	if ext == "" && strings.HasPrefix(filepath.Base(file), ".env") {
+		ext = "env"
+	}
+	format, ok := formats[ext]
+	if !ok {
+		return "", fmt.Errorf("unsupported config format: %s", file)
+	}
+	return format, nil
+}
+
+// normalizeFormat validates a format given by the user, extensions such as yml are accepted
+func normalizeFormat(name string) (string, error) {
+	format, ok := formats[strings.ToLower(name)]
+	if !ok {
+		return "", fmt.Errorf("unsupported config format: %s, supported values: yaml,json,toml,hcl,dotenv", name)
+	}
+	return format, nil
+}
+
+// decode parses data into nested settings with lowercase keys
+func decode(data []byte, format string) (map[string]any, error) {
+	v := viper.New()
+	v.SetConfigType(format)
+	err := v.ReadConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	settings := v.AllSettings()
+	switch format {
+	case "dotenv":
+		settings = nest(settings)
+	case "hcl":
+		settings = unwrapBlocks(settings).(map[string]any)
+	}
+	return settings, nil
+}
+
+// unwrapBlocks merges the list of objects produced by HCL blocks into a single mapping
+func unwrapBlocks(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for k, v := range value {
+			value[k] = unwrapBlocks(v)
+		}
+		return value
+	case []map[string]any:
+		merged := make(map[string]any)
+		for _, m := range value {
+			for k, v := range m {
+				merged[k] = unwrapBlocks(v)
+			}
+		}
+		return merged
+	default:
+		return value
+	}
+}
+
+// nest turns flat dotenv keys such as SETTINGS_LOG_LEVEL into nested settings,
+// the registered keys are used to tell the separators from underscores inside names
+// and to restore the types of their values, the values of unknown keys stay strings
+func nest(flat map[string]any) map[string]any {
+	names := make(map[string]schema.Key)
+	for _, key := range schema.Keys() {
+		names[strings.ReplaceAll(key.Name, ".", "_")] = key
+	}
+
+	settings := make(map[string]any)
+	for k, value := range flat {
+		key, ok := names[k]
+		if !ok {
+			settings[k] = value
+			continue
+		}
+		parts := strings.Split(key.Name, ".")
+		m := settings
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := m[part].(map[string]any)
+			if !ok {
+				child = make(map[string]any)
+				m[part] = child
+			}
+			m = child
+		}
+		m[parts[len(parts)-1]] = typed(key.Type, value)
+	}
+	return settings
+}
+
+// typed converts a dotenv string to the type of the key, the value is kept if it does not parse
+func typed(t schema.Type, value any) any {
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+	switch t {
+	case schema.Bool:
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	case schema.Int:
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+	case schema.Float:
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case schema.StringSlice:
+		if s == "" {
+			return []any{}
+		}
+		items := make([]any, 0)
+		for _, item := range strings.Split(s, ",") {
+			items = append(items, strings.TrimSpace(item))
+		}
+		return items
+	}
+	return value
+}
+
+// parse parses data into a YAML node, comments are only available when the source is YAML
+func parse(data []byte, format string) (*yaml.Node, error) {
+	var doc yaml.Node
+	if format == "yaml" {
+		err := yaml.Unmarshal(data, &doc)
+		if err != nil {
+			return nil, err
+		}
+		if doc.Kind == 0 {
+			doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+		}
+		return &doc, nil
+	}
+
+	settings, err := decode(data, format)
+	if err != nil {
+		return nil, err
+	}
+	var root yaml.Node
+	err = root.Encode(settings)
+	if err != nil {
+		return nil, err
+	}
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&root}}, nil
+}
+
+// encode renders a YAML document node in the given format, keeping comments except for JSON
+func encode(doc *yaml.Node, format string) ([]byte, error) {
+	switch format {
+	case "yaml":
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		err := encoder.Encode(doc)
+		if err != nil {
+			return nil, err
+		}
+		err = encoder.Close()
+		return buf.Bytes(), err
+	case "json":
+		var settings any
+		err := doc.Decode(&settings)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.MarshalIndent(settings, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case "hcl":
+		var buf bytes.Buffer
+		writeComment(&buf, doc.HeadComment, "")
+		err := encodeHCL(&buf, mapping(doc), "")
+		return buf.Bytes(), err
+	case "toml":
+		var buf bytes.Buffer
+		writeComment(&buf, doc.HeadComment, "")
+		err := encodeTOML(&buf, mapping(doc), nil)
+		return buf.Bytes(), err
+	case "dotenv":
+		var buf bytes.Buffer
+		writeComment(&buf, doc.HeadComment, "")
+		err := encodeDotenv(&buf, mapping(doc), nil)
+		return buf.Bytes(), err
+	default:
+		return nil, fmt.Errorf("unsupported config format: %s", format)
+	}
+}
+
+// mapping returns the root mapping of a document
+func mapping(doc *yaml.Node) *yaml.Node {
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		return doc.Content[0]
+	}
+	return doc
+}
+
+func writeComment(buf *bytes.Buffer, comment string, indent string) {
+	if comment == "" {
+		return
+	}
+	for _, line := range strings.Split(comment, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			line = "# " + line
+		}
+		if line != "" {
+			line = indent + line
+		}
+		buf.WriteString(line + "\n")
+	}
+}
+
+func encodeTOML(buf *bytes.Buffer, n *yaml.Node, path []string) error {
+	if n.Kind != yaml.MappingNode {
+		return fmt.Errorf("toml requires a mapping at the top level")
+	}
+
+	// keys with plain values first, then tables
+	var tables []int
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if v.Kind == yaml.MappingNode {
+			tables = append(tables, i)
+			continue
+		}
+		var value any
+		err := v.Decode(&value)
+		if err != nil {
+			return err
+		}
+		// tables inside values such as the list of outputs are written inline,
+		// an array of tables would be placed at the top level
+		var line bytes.Buffer
+		encoder := toml.NewEncoder(&line)
+		encoder.SetTablesInline(true)
+		err = encoder.Encode(map[string]any{k.Value: value})
+		if err != nil {
+			return err
+		}
+		writeComment(buf, k.HeadComment, "")
+		buf.Write(bytes.TrimRight(line.Bytes(), "\n"))
+		if k.LineComment != "" || v.LineComment != "" {
+			buf.WriteString(" " + strings.TrimSpace(k.LineComment+v.LineComment))
+		}
+		buf.WriteString("\n")
+	}
+
+	for _, i := range tables {
+		k, v := n.Content[i], n.Content[i+1]
+		table := append(append([]string(nil), path...), tomlKey(k.Value))
+		writeComment(buf, k.HeadComment, "")
+		if hasValues(v) {
+			if buf.Len() > 0 {
+				buf.WriteString("\n")
+			}
+			buf.WriteString("[" + strings.Join(table, ".") + "]\n")
+		}
+		err := encodeTOML(buf, v, table)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasValues reports whether a mapping has plain values or is empty, otherwise its table header is implied
+func hasValues(n *yaml.Node) bool {
+	if len(n.Content) == 0 {
+		return true
+	}
+	for i := 1; i < len(n.Content); i += 2 {
+		if n.Content[i].Kind != yaml.MappingNode {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeHCL writes the mappings as blocks and the other values as attributes
+func encodeHCL(buf *bytes.Buffer, n *yaml.Node, indent string) error {
+	if n.Kind != yaml.MappingNode {
+		return fmt.Errorf("hcl requires a mapping at the top level")
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		writeComment(buf, k.HeadComment, indent)
+		if v.Kind == yaml.MappingNode {
+			buf.WriteString(indent + hclKey(k.Value) + " {\n")
+			err := encodeHCL(buf, v, indent+"  ")
+			if err != nil {
+				return err
+			}
+			buf.WriteString(indent + "}\n")
+			continue
+		}
+
+		var value any
+		err := v.Decode(&value)
+		if err != nil {
+			return err
+		}
+		text, err := hclValue(value, indent)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(indent + hclKey(k.Value) + " = " + text)
+		if k.LineComment != "" || v.LineComment != "" {
+			buf.WriteString(" " + strings.TrimSpace(k.LineComment+v.LineComment))
+		}
+		buf.WriteString("\n")
+	}
+	return nil
+}
+
+// hclValue renders a value in HCL syntax, HCL has no null so it is rendered as an empty string
+func hclValue(value any, indent string) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return `""`, nil
+	case map[string]any:
+		if len(value) == 0 {
+			return "{}", nil
+		}
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var b strings.Builder
+		b.WriteString("{\n")
+		for _, k := range keys {
+			text, err := hclValue(value[k], indent+"  ")
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(indent + "  " + hclKey(k) + " = " + text + "\n")
+		}
+		b.WriteString(indent + "}")
+		return b.String(), nil
+	case []any:
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			text, err := hclValue(item, indent)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, text)
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	default:
+		// the JSON literals of strings, numbers and booleans are valid in HCL
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		err := encoder.Encode(value)
+		return strings.TrimSuffix(buf.String(), "\n"), err
+	}
+}
+
+func hclKey(key string) string {
+	for i, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_' || i > 0 && (r >= '0' && r <= '9' || r == '-')) {
+			return strconv.Quote(key)
+		}
+	}
+	if key == "" {
+		return `""`
+	}
+	return key
+}
+
+func tomlKey(key string) string {
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return strconv.Quote(key)
+		}
+	}
+	return key
+}
+
+// encodeDotenv writes the registered keys as variables, the values a variable cannot hold,
+// such as lists of mappings, the names of a Map key and unknown keys, are rejected
+func encodeDotenv(buf *bytes.Buffer, n *yaml.Node, path []string) error {
+	if n.Kind != yaml.MappingNode {
+		return fmt.Errorf("dotenv requires a mapping at the top level")
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		name := append(append([]string(nil), path...), k.Value)
+		dotted := strings.ToLower(strings.Join(name, "."))
+		key, registered := schema.Lookup(dotted)
+		if registered && (key.Type == schema.Map || key.Type == schema.List) {
+			// empty mappings and lists are dropped like the empty sections
+			if len(v.Content) == 0 {
+				continue
+			}
+			return fmt.Errorf("%s: a %s value cannot be converted to dotenv", dotted, key.Type)
+		}
+		writeComment(buf, k.HeadComment, "")
+		if v.Kind == yaml.MappingNode {
+			err := encodeDotenv(buf, v, name)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if !registered {
+			return fmt.Errorf("%s: unknown keys cannot be converted to dotenv", dotted)
+		}
+
+		var value any
+		err := v.Decode(&value)
+		if err != nil {
+			return err
+		}
+		var text string
+		switch value := value.(type) {
+		case []any:
+			items := make([]string, 0, len(value))
+			for _, item := range value {
+				switch item.(type) {
+				case map[string]any, []any:
+					return fmt.Errorf("%s: nested values cannot be converted to dotenv", dotted)
+				}
+				items = append(items, fmt.Sprint(item))
+			}
+			text = strings.Join(items, ",")
+		case map[string]any:
+			return fmt.Errorf("%s: nested values cannot be converted to dotenv", dotted)
+		case nil:
+		default:
+			text = fmt.Sprint(value)
+		}
+		if text == "" || strings.ContainsAny(text, " \t#'\"\\$=") {
+			text = strconv.Quote(text)
+		}
+		fmt.Fprintf(buf, "%s=%s\n", strings.ToUpper(strings.Join(name, "_")), text)
+	}
+	return nil
+}
+
+// flatten returns the dotted names of all leaf keys
+func flatten(settings map[string]any, prefix string) []string {
+	var keys []string
+	for k, v := range settings {
+		name := k
+		if prefix != "" {
+			name = prefix + "." + k
+		}
+		if m, ok := v.(map[string]any); ok && len(m) > 0 {
+			if _, leaf := schema.Lookup(name); !leaf {
+				keys = append(keys, flatten(m, name)...)
+				continue
+			}
+		}
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	return keys
+}
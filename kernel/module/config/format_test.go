@@ -0,0 +1,179 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vvfock3r/gooey/kernel/schema"
+)
+
+func init() {
+	schema.Register(
+		schema.Key{Name: "settings.format.enabled", Type: schema.Bool},
+		schema.Key{Name: "settings.format.count", Type: schema.Int},
+		schema.Key{Name: "settings.format.ratio", Type: schema.Float},
+		schema.Key{Name: "settings.format.tags", Type: schema.StringSlice},
+		schema.Key{Name: "settings.format.name", Type: schema.String},
+		schema.Key{Name: "settings.format.outputs", Type: schema.List},
+		schema.Key{Name: "settings.format.levels", Type: schema.Map},
+	)
+}
+
+const formatSource = `# head comment
+settings:
+  # format section
+  format:
+    enabled: true # line comment
+    count: 3
+    ratio: 0.5
+    tags: [a, b]
+    name: "x y"
+`
+
+func TestConvertHCL(t *testing.T) {
+	doc, err := parse([]byte(formatSource), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := encode(doc, "hcl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, comment := range []string{"# head comment", "  # format section", "enabled = true # line comment"} {
+		if !strings.Contains(string(data), comment) {
+			t.Errorf("comment %q is missing in:\n%s", comment, data)
+		}
+	}
+
+	got, err := decode(data, "hcl")
+	if err != nil {
+		t.Fatalf("%v in:\n%s", err, data)
+	}
+	want, err := decode([]byte(formatSource), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip got %v, want %v", got, want)
+	}
+}
+
+func TestConvertDotenv(t *testing.T) {
+	doc, err := parse([]byte(formatSource), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := encode(doc, "dotenv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decode(data, "dotenv")
+	if err != nil {
+		t.Fatalf("%v in:\n%s", err, data)
+	}
+
+	format := got["settings"].(map[string]any)["format"].(map[string]any)
+	want := map[string]any{
+		"enabled": true,
+		"count":   int64(3),
+		"ratio":   0.5,
+		"tags":    []any{"a", "b"},
+		"name":    "x y",
+	}
+	if !reflect.DeepEqual(format, want) {
+		t.Errorf("round trip got %#v, want %#v", format, want)
+	}
+}
+
+const nestedSource = `settings:
+  format:
+    name: app
+    # outputs with their own rotation
+    outputs:
+      - output: stdout
+        format: console
+      - output: app.log
+        rotation:
+          max_size: 1MB
+    levels:
+      mysql: debug
+`
+
+func TestConvertTOMLCheck(t *testing.T) {
+	doc, err := parse([]byte(nestedSource), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := encode(doc, "toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "# outputs with their own rotation") {
+		t.Errorf("comment is missing in:\n%s", data)
+	}
+
+	got, err := decode(data, "toml")
+	if err != nil {
+		t.Fatalf("%v in:\n%s", err, data)
+	}
+	want, err := decode([]byte(nestedSource), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip got %v, want %v in:\n%s", got, want, data)
+	}
+
+	// the converted file passes config check
+	f := &loadedFile{name: "config.toml", format: "toml", data: data}
+	checked, err := f.document()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = schema.Validate(checked, func(key string) any {
+		value, _ := lookup(got, key)
+		return value
+	})
+	if err != nil {
+		t.Errorf("converted file is rejected: %v\n%s", err, data)
+	}
+}
+
+func TestConvertDotenvUnsupported(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		wantErr string
+	}{
+		{"list of mappings", "settings:\n  format:\n    outputs:\n      - output: stdout\n", "settings.format.outputs"},
+		{"map key", "settings:\n  format:\n    levels:\n      mysql: debug\n", "settings.format.levels"},
+		{"unknown key", "settings:\n  format:\n    other: 1\n", "settings.format.other"},
+		{"nested list", "settings:\n  format:\n    tags: [[a]]\n", "settings.format.tags"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parse([]byte(tt.source), "yaml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := encode(doc, "dotenv")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want one about %s, output:\n%s", err, tt.wantErr, data)
+			}
+		})
+	}
+
+	// empty mappings and lists are dropped
+	doc, err := parse([]byte("settings:\n  format:\n    name: app\n    outputs: []\n    levels: {}\n"), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := encode(doc, "dotenv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "SETTINGS_FORMAT_NAME=app\n" {
+		t.Errorf("got %q", data)
+	}
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vvfock3r/gooey/kernel/schema"
+)
+
+// includeKey lists the files included by a config file
+const includeKey = "include"
+
+// keys declares the configuration keys of the config module
+var keys = []schema.Key{
+	{
+		Name:    includeKey,
+		Type:    schema.StringSlice,
+		Default: []string{},
+		Description: schema.Text{
+			"zh": "包含的其他配置文件,相对路径基于当前文件所在目录,支持通配符,当前文件的配置优先,远程配置文件不支持",
+			"en": "other config files to include, relative to the directory of this file, globs are supported, this file takes precedence, not supported in a remote config file",
+		},
+	},
+}
+
+// resolve decodes a config file and merges the files it includes beneath it,
+// returning the merged settings and all files read, the including file first
+func resolve(f loadedFile, chain []string) (map[string]any, []loadedFile, error) {
+	settings, err := decode(f.data, f.format)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", f.name, err)
+	}
+
+	// upgrade to the latest schema version and rename the deprecated keys
+	tree := &schema.MapTree{Settings: settings}
+	report, err := schema.Migrate(tree)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", f.name, err)
+	}
+	warnMigration(f.name, report)
+	f.moves, f.migrated = tree.Moves, report.Changed()
+
+	name := f.name
+	if isLocal(name) {
+		name, err = filepath.Abs(name)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, included := range chain {
+		if included == name {
+			return nil, nil, fmt.Errorf("config include cycle: %s -> %s", strings.Join(chain, " -> "), name)
+		}
+	}
+	chain = append(chain, name)
+
+	patterns, err := includes(settings[includeKey])
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", f.name, err)
+	}
+
+	// a remote config file must not pull in local files, which are neither fetched nor verified with it
+	if isURL(name) && len(patterns) > 0 {
+		return nil, nil, fmt.Errorf("%s: %s is not supported in a remote config file", f.name, includeKey)
+	}
+
+	merged := make(map[string]any)
+	files := []loadedFile{f}
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) && isLocal(name) {
+			pattern = filepath.Join(filepath.Dir(name), pattern)
+		}
+		names, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", f.name, err)
+		}
+		if names == nil && !strings.ContainsAny(pattern, "*?[") {
+			return nil, nil, fmt.Errorf("%s: included file not found: %s", f.name, pattern)
+		}
+
+		for _, includedName := range names {
+			format, err := formatOf(includedName)
+			if err != nil {
+				return nil, nil, err
+			}
+			data, err := os.ReadFile(includedName)
+			if err != nil {
+				return nil, nil, err
+			}
+			sub, subFiles, err := resolve(loadedFile{name: includedName, format: format, data: data}, chain)
+			if err != nil {
+				return nil, nil, err
+			}
+			mergeMaps(merged, sub)
+			files = append(files, subFiles...)
+		}
+	}
+
+	delete(merged, includeKey)
+	mergeMaps(merged, settings)
+	return merged, files, nil
+}
+
+// includes returns the include patterns, a single string or a list of strings
+func includes(value any) ([]string, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if strings.TrimSpace(value) == "" {
+			return nil, nil
+		}
+		return strings.Split(value, ","), nil
+	case []any:
+		patterns := make([]string, 0, len(value))
+		for _, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a list of strings", includeKey)
+			}
+			patterns = append(patterns, s)
+		}
+		return patterns, nil
+	default:
+		return nil, fmt.Errorf("%s must be a string or a list of strings", includeKey)
+	}
+}
+
+// mergeMaps merges src into dst recursively, values of src take precedence
+func mergeMaps(dst, src map[string]any) {
+	for k, v := range src {
+		srcMap, ok := v.(map[string]any)
+		if !ok {
+			dst[k] = v
+			continue
+		}
+		dstMap, ok := dst[k].(map[string]any)
+		if !ok {
+			dstMap = make(map[string]any)
+			dst[k] = dstMap
+		}
+		mergeMaps(dstMap, srcMap)
+	}
+}
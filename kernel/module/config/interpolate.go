@@ -0,0 +1,170 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// interpolator resolves ${VAR}, ${VAR:-default} and ${settings.other.key} inside string values,
+// a reference containing a dot is a config key, otherwise an environment variable, $${ escapes ${
+type interpolator struct {
+	settings map[string]any
+	resolved map[string]any
+	visiting []string
+}
+
+// interpolate resolves all references in settings in place
+func interpolate(settings map[string]any) error {
+	in := &interpolator{settings: settings, resolved: make(map[string]any)}
+	return in.walk("", settings)
+}
+
+func (in *interpolator) walk(prefix string, m map[string]any) error {
+	for k, v := range m {
+		name := k
+		if prefix != "" {
+			name = prefix + "." + k
+		}
+		value, err := in.value(name, v)
+		if err != nil {
+			return err
+		}
+		m[k] = value
+	}
+	return nil
+}
+
+func (in *interpolator) value(name string, v any) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		return v, in.walk(name, v)
+	case []any:
+		for i, item := range v {
+			value, err := in.value(fmt.Sprintf("%s[%d]", name, i), item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = value
+		}
+		return v, nil
+	case string:
+		return in.key(name, v)
+	default:
+		return v, nil
+	}
+}
+
+// key resolves the value of a key, detecting reference cycles
+func (in *interpolator) key(name string, raw string) (any, error) {
+	if value, ok := in.resolved[name]; ok {
+		return value, nil
+	}
+	for i, visiting := range in.visiting {
+		if visiting == name {
+			chain := append(append([]string(nil), in.visiting[i:]...), name)
+			return nil, fmt.Errorf("config interpolation cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+
+	in.visiting = append(in.visiting, name)
+	value, err := in.expand(name, raw)
+	in.visiting = in.visiting[:len(in.visiting)-1]
+	if err != nil {
+		return nil, err
+	}
+	in.resolved[name] = value
+	return value, nil
+}
+
+// expand replaces the references in s, a string that is a single reference keeps the type of the referenced value
+func (in *interpolator) expand(name string, s string) (any, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var (
+		b    strings.Builder
+		rest = s
+	)
+	for {
+		i := strings.Index(rest, "${")
+		if i < 0 {
+			b.WriteString(rest)
+			break
+		}
+		if i > 0 && rest[i-1] == '$' {
+			b.WriteString(rest[:i-1] + "${")
+			rest = rest[i+2:]
+			continue
+		}
+		end := strings.Index(rest[i:], "}")
+		if end < 0 {
+			return nil, fmt.Errorf("%s: unterminated reference in %q", name, s)
+		}
+		expr := rest[i+2 : i+end]
+
+		value, err := in.reference(name, expr)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 && end == len(rest)-1 && b.Len() == 0 {
+			// the whole value is a single reference
+			return value, nil
+		}
+		b.WriteString(rest[:i])
+		b.WriteString(fmt.Sprint(value))
+		rest = rest[i+end+1:]
+	}
+	return b.String(), nil
+}
+
+// reference resolves a single expression such as VAR, VAR:-default or settings.other.key
+func (in *interpolator) reference(name string, expr string) (any, error) {
+	ref, fallback, hasFallback := strings.Cut(expr, ":-")
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return nil, fmt.Errorf("%s: empty reference ${%s}", name, expr)
+	}
+
+	var value any
+	if strings.Contains(ref, ".") {
+		key := strings.ToLower(ref)
+		raw, ok := lookup(in.settings, key)
+		if ok {
+			var err error
+			value, err = in.value(key, raw)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else if env, ok := os.LookupEnv(ref); ok {
+		value = env
+	}
+
+	if value == nil || value == "" {
+		if hasFallback {
+			return fallback, nil
+		}
+		if value == nil {
+			return nil, fmt.Errorf("%s: undefined reference ${%s}", name, expr)
+		}
+	}
+	return value, nil
+}
+
+// lookup returns the value of a dotted key
+func lookup(settings map[string]any, key string) (any, bool) {
+	var value any = settings
+	for _, part := range strings.Split(key, ".") {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		value, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
@@ -0,0 +1,282 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"github.com/vvfock3r/gooey/kernel/schema"
+)
+
+// warnMigration logs the deprecated keys and migrations applied in memory to a config file
+func warnMigration(name string, report schema.Report) {
+	for _, d := range report.Deprecated {
+		log().Warn("deprecated config key",
+			zap.String("filename", name),
+			zap.String("key", d.Old),
+			zap.String("replacement", d.New))
+	}
+	if report.From != report.To {
+		log().Warn("config migrated in memory, run 'config migrate' to update the file",
+			zap.String("filename", name),
+			zap.Int("from", report.From),
+			zap.Int("to", report.To))
+	}
+}
+
+func (c *Config) migrateCommand() *cobra.Command {
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "migrate [file]",
+		Short: "Rewrite a configuration file to the latest schema version",
+		Long: "Rewrite a configuration file to the latest schema version\n" +
+			"A diff is printed before the file is rewritten and the original file is kept as a backup",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := c.flag
+			if len(args) > 0 {
+				name = args[0]
+			}
+			if name == "" {
+				names, err := c.find()
+				if err != nil {
+					return err
+				}
+				name = names[0]
+			}
+			if name == stdin {
+				return fmt.Errorf("cannot migrate the configuration read from stdin")
+			}
+
+			info, err := os.Stat(name)
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(name)
+			if err != nil {
+				return err
+			}
+			format, err := formatOf(name)
+			if err != nil {
+				return err
+			}
+
+			content, report, err := migrate(data, format)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			if !report.Changed() {
+				fmt.Printf("%s is already at the latest schema version %d\n", name, report.To)
+				return nil
+			}
+
+			fmt.Printf("--- %s (version %d)\n+++ %s (version %d)\n", name, report.From, name, report.To)
+			fmt.Print(diff(string(data), string(content)))
+			for _, description := range report.Applied {
+				fmt.Printf("migration: %s\n", description)
+			}
+			for _, d := range report.Deprecated {
+				fmt.Printf("deprecated: %s -> %s\n", d.Old, d.New)
+			}
+			if dryRun {
+				return nil
+			}
+
+			backup := fmt.Sprintf("%s.%s.bak", name, time.Now().Format("20060102150405"))
+			err = os.WriteFile(backup, data, info.Mode().Perm())
+			if err != nil {
+				return err
+			}
+			err = writeFile(name, content, info.Mode().Perm(), true)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("backup: %s\n", backup)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "only print the diff, do not rewrite the file")
+	return cmd
+}
+
+// migrate upgrades the content of a config file, YAML comments are kept
+func migrate(data []byte, format string) ([]byte, schema.Report, error) {
+	doc, err := parse(data, format)
+	if err != nil {
+		return nil, schema.Report{}, err
+	}
+
+	report, err := schema.Migrate(&nodeTree{root: mapping(doc)})
+	if err != nil || !report.Changed() {
+		return data, report, err
+	}
+
+	content, err := encode(doc, format)
+	return content, report, err
+}
+
+// nodeTree implements schema.Tree on a YAML mapping node, comments move along with their keys
+type nodeTree struct {
+	root *yaml.Node
+}
+
+func (t *nodeTree) Get(key string) (any, bool) {
+	parent, i := t.find(key)
+	if parent == nil {
+		return nil, false
+	}
+	var value any
+	err := parent.Content[i+1].Decode(&value)
+	return value, err == nil
+}
+
+func (t *nodeTree) Set(key string, value any) {
+	var node yaml.Node
+	err := node.Encode(value)
+	if err != nil {
+		return
+	}
+	parent, i := t.find(key)
+	if parent != nil {
+		parent.Content[i+1] = &node
+		return
+	}
+	parent, name := t.parent(key)
+	pair := []*yaml.Node{{Kind: yaml.ScalarNode, Tag: "!!str", Value: name}, &node}
+	if parent == t.root {
+		// top level keys such as schema_version go first
+		parent.Content = append(pair, parent.Content...)
+		return
+	}
+	parent.Content = append(parent.Content, pair...)
+}
+
+func (t *nodeTree) Delete(key string) {
+	parent, i := t.find(key)
+	if parent == nil {
+		return
+	}
+	parent.Content = append(parent.Content[:i], parent.Content[i+2:]...)
+	t.prune(key)
+}
+
+func (t *nodeTree) Move(from, to string) bool {
+	parent, i := t.find(from)
+	if parent == nil {
+		return false
+	}
+	k, v := parent.Content[i], parent.Content[i+1]
+	t.Delete(from)
+
+	if target, j := t.find(to); target != nil {
+		target.Content = append(target.Content[:j], target.Content[j+2:]...)
+	}
+	target, name := t.parent(to)
+	k.Value = name
+	target.Content = append(target.Content, k, v)
+	return true
+}
+
+// find returns the mapping holding key and the index of its key node
+func (t *nodeTree) find(key string) (*yaml.Node, int) {
+	n := t.root
+	parts := strings.Split(strings.ToLower(key), ".")
+	for depth, part := range parts {
+		if n == nil || n.Kind != yaml.MappingNode {
+			return nil, 0
+		}
+		next := (*yaml.Node)(nil)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if strings.ToLower(n.Content[i].Value) != part {
+				continue
+			}
+			if depth == len(parts)-1 {
+				return n, i
+			}
+			next = n.Content[i+1]
+			break
+		}
+		n = next
+	}
+	return nil, 0
+}
+
+// parent returns the mapping that should hold key, creating it if needed, and the last part of key
+func (t *nodeTree) parent(key string) (*yaml.Node, string) {
+	parts := strings.Split(strings.ToLower(key), ".")
+	n := t.root
+	for depth := range parts[:len(parts)-1] {
+		p, i := t.find(strings.Join(parts[:depth+1], "."))
+		if p != nil && p.Content[i+1].Kind == yaml.MappingNode {
+			n = p.Content[i+1]
+			continue
+		}
+		child := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		if p != nil {
+			p.Content[i+1] = child
+		} else {
+			n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: parts[depth]}, child)
+		}
+		n = child
+	}
+	return n, parts[len(parts)-1]
+}
+
+// prune removes the empty mappings left on the path of a deleted key
+func (t *nodeTree) prune(key string) {
+	parts := strings.Split(strings.ToLower(key), ".")
+	for i := len(parts) - 1; i > 0; i-- {
+		p, j := t.find(strings.Join(parts[:i], "."))
+		if p == nil || p.Content[j+1].Kind != yaml.MappingNode || len(p.Content[j+1].Content) > 0 {
+			return
+		}
+		p.Content = append(p.Content[:j], p.Content[j+2:]...)
+	}
+}
+
+// diff returns a line diff of a and b, unchanged lines are prefixed with a space
+func diff(a, b string) string {
+	x := strings.Split(strings.TrimSuffix(a, "\n"), "\n")
+	y := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+
+	// longest common subsequence
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			buf.WriteString(" " + x[i] + "\n")
+			i++
+			j++
+		case j < len(y) && (i == len(x) || lcs[i][j+1] >= lcs[i+1][j]):
+			buf.WriteString("+" + y[j] + "\n")
+			j++
+		default:
+			buf.WriteString("-" + x[i] + "\n")
+			i++
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vvfock3r/gooey/kernel/module/mysql"
+)
+
+const migrateSource = `settings:
+  mysql:
+    # the password of the driver DSN
+    passwd: secret # line comment
+    dbname: demo
+    port: 3306
+`
+
+func TestMigrateCommand(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(file, []byte(migrateSource), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := &cobra.Command{Use: "gooey"}
+	(&mysql.MySQL{}).Register(root)
+	(&Config{}).Register(root)
+
+	// a dry run only prints the diff
+	root.SetArgs([]string{"config", "migrate", "--dry-run", file})
+	err = root.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != migrateSource {
+		t.Fatalf("dry run rewrote the file:\n%s", data)
+	}
+
+	// flags keep their values across executions
+	root.SetArgs([]string{"config", "migrate", "--dry-run=false", file})
+	err = root.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(data)
+	if !strings.HasPrefix(content, "schema_version: 2\n") {
+		t.Errorf("schema_version is not written at the top of the migrated file:\n%s", content)
+	}
+	for _, want := range []string{"# the password of the driver DSN", "password: secret # line comment", "database: demo", "port: 3306"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("%q is missing in the migrated file:\n%s", want, content)
+		}
+	}
+	for _, old := range []string{"mysql", "passwd", "dbname"} {
+		if strings.Contains(content, old+":") {
+			t.Errorf("deprecated key %s is left in the migrated file:\n%s", old, content)
+		}
+	}
+
+	// settings.mysql moved to settings.databases.default
+	settings, err := decode(data, "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]any{
+		"settings.databases.default.password": "secret",
+		"settings.databases.default.database": "demo",
+		"settings.databases.default.port":     3306,
+	} {
+		got, ok := lookup(settings, key)
+		if !ok || got != want {
+			t.Errorf("%s is %v (found %v), want %v", key, got, ok, want)
+		}
+	}
+	if _, ok := lookup(settings, "settings.mysql"); ok {
+		t.Errorf("settings.mysql is left in the migrated file:\n%s", content)
+	}
+
+	backups, err := filepath.Glob(file + ".*.bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("got backups %v, want one", backups)
+	}
+	backup, err := os.ReadFile(backups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(backup) != migrateSource {
+		t.Errorf("backup differs from the original file:\n%s", backup)
+	}
+
+	// the migrated file is at the latest version
+	_, report, err := migrate(data, "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Changed() {
+		t.Errorf("migrating the file again changed it: %+v", report)
+	}
+}
@@ -0,0 +1,325 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// maxRemoteSize limits the size of a remote config file
+const maxRemoteSize = 8 << 20
+
+// Remote fetches the configuration from an HTTP endpoint, YAML and JSON are supported,
+// URL, Token and PublicKey are expanded with os.ExpandEnv
+type Remote struct {
+	// URL of the config file, -c / --config also accepts an http(s) URL
+	URL string
+	// Token is sent as a bearer token if not empty
+	Token string
+	// PublicKey is a base64 ed25519 public key, if set the detached signature at URL + ".sig" is verified
+	PublicKey string
+	// Cache is the file keeping the last good copy for offline starts, defaults to the user cache directory
+	Cache string
+	// Interval is the polling interval used by the watch module, defaults to 30s
+	Interval time.Duration
+	// Client defaults to an http.Client with a 10s timeout
+	Client *http.Client
+
+	mu     sync.Mutex
+	data   []byte
+	format string
+	etag   string
+	polled bool
+}
+
+// remote is the remote source in use, nil if the configuration is read from files
+var remote *Remote
+
+// isURL reports whether a config file name is a remote URL
+func isURL(name string) bool {
+	return strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")
+}
+
+// isLocal reports whether a config file name is a file on disk
+func isLocal(name string) bool {
+	return name != stdin && !isURL(name)
+}
+
+// Fetch downloads the config file, it reports whether the content changed since the last fetch,
+// an unchanged ETag is answered with 304 Not Modified by the server
+func (r *Remote) Fetch(ctx context.Context) (bool, error) {
+	r.mu.Lock()
+	etag, previous := r.etag, r.data
+	r.mu.Unlock()
+
+	resp, err := r.get(ctx, r.URL, etag)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return false, nil
+	default:
+		return false, fmt.Errorf("%s: %s", r.URL, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteSize+1))
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", r.URL, err)
+	}
+	if len(data) > maxRemoteSize {
+		return false, fmt.Errorf("%s: config file exceeds %d bytes", r.URL, maxRemoteSize)
+	}
+	signature, err := r.verify(ctx, data)
+	if err != nil {
+		return false, err
+	}
+	format := remoteFormat(r.URL, resp.Header.Get("Content-Type"), data)
+
+	r.mu.Lock()
+	r.data, r.format, r.etag = data, format, resp.Header.Get("ETag")
+	r.mu.Unlock()
+
+	// a failed cache write only affects offline starts
+	err = r.save(data, signature)
+	if err != nil {
+		log().Warn("config cache write failed", zap.String("filename", r.cache()), zap.Error(err))
+	}
+	return !bytes.Equal(previous, data), nil
+}
+
+// get sends a GET request with the bearer token
+func (r *Remote) get(ctx context.Context, url string, etag string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/yaml, application/json")
+	if token := os.ExpandEnv(r.Token); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	client := r.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return client.Do(req)
+}
+
+// publicKey returns the key verifying the signatures, nil if none is configured
+func (r *Remote) publicKey() (ed25519.PublicKey, error) {
+	publicKey := strings.TrimSpace(os.ExpandEnv(r.PublicKey))
+	if publicKey == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid config public key, a base64 ed25519 public key is required")
+	}
+	return key, nil
+}
+
+// verify checks the detached ed25519 signature of data, raw or base64 encoded,
+// it returns the signature, nil if no public key is configured
+func (r *Remote) verify(ctx context.Context, data []byte) ([]byte, error) {
+	key, err := r.publicKey()
+	if key == nil || err != nil {
+		return nil, err
+	}
+
+	resp, err := r.get(ctx, r.URL+".sig", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s.sig: %s", r.URL, resp.Status)
+	}
+	signature, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return nil, fmt.Errorf("%s.sig: %w", r.URL, err)
+	}
+	return signature, checkSignature(key, data, signature, r.URL)
+}
+
+func checkSignature(key ed25519.PublicKey, data []byte, signature []byte, name string) error {
+	if len(signature) != ed25519.SignatureSize {
+		var err error
+		signature, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil {
+			return fmt.Errorf("%s.sig: invalid signature encoding", name)
+		}
+	}
+	if !ed25519.Verify(key, data, signature) {
+		return fmt.Errorf("%s: signature verification failed", name)
+	}
+	return nil
+}
+
+// cache returns the path of the cached copy, the default file is named after the URL
+// so that applications reading different URLs do not share it
+func (r *Remote) cache() string {
+	if r.Cache != "" {
+		return os.ExpandEnv(r.Cache)
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	sum := sha256.Sum256([]byte(r.URL))
+	return filepath.Join(dir, "gooey", "remote-config-"+hex.EncodeToString(sum[:8]))
+}
+
+// save replaces the cached copy and its signature, they may hold secrets so only the owner can read them
+func (r *Remote) save(data []byte, signature []byte) error {
+	name := r.cache()
+	err := os.MkdirAll(filepath.Dir(name), 0700)
+	if err != nil {
+		return err
+	}
+	if signature == nil {
+		err = os.Remove(name + ".sig")
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		err = writeAtomic(name+".sig", signature)
+		if err != nil {
+			return err
+		}
+	}
+	return writeAtomic(name, data)
+}
+
+// writeAtomic replaces a file by renaming a temporary file readable by the owner only
+func writeAtomic(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err1 := tmp.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// load fetches the config file, falling back to the cached copy if the endpoint is unreachable,
+// the cached copy is verified against its saved signature as well
+func (r *Remote) load(ctx context.Context) error {
+	key, err := r.publicKey()
+	if err != nil {
+		return err
+	}
+	_, err = r.Fetch(ctx)
+	if err == nil {
+		return nil
+	}
+
+	name := r.cache()
+	data, cacheErr := os.ReadFile(name)
+	if cacheErr == nil && key != nil {
+		var signature []byte
+		signature, cacheErr = os.ReadFile(name + ".sig")
+		if cacheErr == nil {
+			cacheErr = checkSignature(key, data, signature, name)
+		}
+	}
+	if cacheErr != nil {
+		return fmt.Errorf("%w, no usable cached copy: %v", err, cacheErr)
+	}
+	log().Warn("remote config unavailable, using the cached copy",
+		zap.String("url", r.URL),
+		zap.String("filename", name),
+		zap.String("detail", err.Error()))
+
+	r.mu.Lock()
+	r.data, r.format = data, remoteFormat(r.URL, "", data)
+	r.mu.Unlock()
+	return nil
+}
+
+// content returns the last fetched config file and its format
+func (r *Remote) content() ([]byte, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.data, r.format
+}
+
+// poll fetches the config file every Interval and calls onChange when it changed
+func (r *Remote) poll(onChange func(name string)) {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	for range time.Tick(interval) {
+		changed, err := r.Fetch(context.Background())
+		if err != nil {
+			log().Warn("remote config poll failed", zap.String("url", r.URL), zap.Error(err))
+			continue
+		}
+		if changed {
+			onChange(r.URL)
+		}
+	}
+}
+
+// WatchRemote starts polling the remote config source, onChange is called after the content changed,
+// it reports false if the configuration is not read from a remote source
+func WatchRemote(onChange func(name string)) bool {
+	r := remote
+	if r == nil {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.polled {
+		r.polled = true
+		go r.poll(onChange)
+	}
+	return true
+}
+
+// remoteFormat detects the format by the URL path, the Content-Type header, or the content
+func remoteFormat(rawURL string, contentType string, data []byte) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		if format, err := formatOf(path.Base(u.Path)); err == nil && (format == "yaml" || format == "json") {
+			return format
+		}
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && strings.HasSuffix(mediaType, "json") {
+		return "json"
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return "json"
+	}
+	return "yaml"
+}
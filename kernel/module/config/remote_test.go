@@ -0,0 +1,188 @@
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const remoteSource = "settings:\n  log:\n    level: debug\n"
+
+// remoteServer serves remoteSource with an ETag and its signature, if sig is not nil
+func remoteServer(t *testing.T, sig []byte) (*httptest.Server, *[]string) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path+" "+r.Header.Get("If-None-Match"))
+		switch r.URL.Path {
+		case "/config.yaml":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			_, _ = w.Write([]byte(remoteSource))
+		case "/config.yaml.sig":
+			if sig == nil {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write(sig)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestRemoteNotModified(t *testing.T) {
+	server, requests := remoteServer(t, nil)
+	r := &Remote{URL: server.URL + "/config.yaml", Cache: filepath.Join(t.TempDir(), "cache")}
+
+	changed, err := r.Fetch(context.Background())
+	if err != nil || !changed {
+		t.Fatalf("first fetch: changed %v, err %v", changed, err)
+	}
+	changed, err = r.Fetch(context.Background())
+	if err != nil || changed {
+		t.Fatalf("second fetch: changed %v, err %v", changed, err)
+	}
+	if got := (*requests)[1]; got != `/config.yaml "v1"` {
+		t.Errorf("second request %q, want the ETag sent", got)
+	}
+	data, format := r.content()
+	if string(data) != remoteSource || format != "yaml" {
+		t.Errorf("content %q %s after 304, want the fetched copy", data, format)
+	}
+}
+
+func TestRemoteSignature(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := ed25519.Sign(privateKey, []byte(remoteSource))
+	badSig := ed25519.Sign(privateKey, []byte("other"))
+
+	tests := []struct {
+		name    string
+		sig     []byte
+		wantErr string
+	}{
+		{"raw", sig, ""},
+		{"base64", []byte(base64.StdEncoding.EncodeToString(sig) + "\n"), ""},
+		{"bad", badSig, "signature verification failed"},
+		{"invalid", []byte("not a signature"), "invalid signature encoding"},
+		{"missing", nil, "404"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := remoteServer(t, tt.sig)
+			r := &Remote{
+				URL:       server.URL + "/config.yaml",
+				PublicKey: base64.StdEncoding.EncodeToString(publicKey),
+				Cache:     filepath.Join(t.TempDir(), "cache"),
+			}
+			_, err := r.Fetch(context.Background())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+			if data, _ := r.content(); data != nil {
+				t.Errorf("unverified content is kept: %q", data)
+			}
+			if _, err := os.Stat(r.Cache); !os.IsNotExist(err) {
+				t.Errorf("unverified content is cached: %v", err)
+			}
+		})
+	}
+}
+
+func TestRemoteCacheFallback(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, _ := remoteServer(t, ed25519.Sign(privateKey, []byte(remoteSource)))
+	cache := filepath.Join(t.TempDir(), "cache")
+	newRemote := func() *Remote {
+		return &Remote{URL: server.URL + "/config.yaml", PublicKey: base64.StdEncoding.EncodeToString(publicKey), Cache: cache}
+	}
+
+	err = newRemote().load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	// the verified cached copy is used while the server is down
+	r := newRemote()
+	err = r.load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := r.content(); string(data) != remoteSource {
+		t.Errorf("got %q from the cache, want %q", data, remoteSource)
+	}
+
+	// a tampered cached copy is rejected
+	err = os.WriteFile(cache, []byte("settings:\n  log:\n    level: error\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = newRemote().load(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "signature verification failed") {
+		t.Fatalf("got error %v, want a signature verification failure", err)
+	}
+
+	// so is a cached copy without signature
+	err = os.Remove(cache + ".sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = newRemote().load(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "no usable cached copy") {
+		t.Fatalf("got error %v, want no usable cached copy", err)
+	}
+}
+
+func TestRemoteCacheByURL(t *testing.T) {
+	a := (&Remote{URL: "https://example.com/a.yaml"}).cache()
+	b := (&Remote{URL: "https://example.com/b.yaml"}).cache()
+	if a == b {
+		t.Errorf("different URLs share the cache file %s", a)
+	}
+}
+
+func TestRemoteRejectsInclude(t *testing.T) {
+	local := filepath.Join(t.TempDir(), "local.yaml")
+	err := os.WriteFile(local, []byte(remoteSource), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, include := range []string{local, "local.yaml", "*.yaml"} {
+		data := "include: [\"" + include + "\"]\n" + remoteSource
+		_, _, err := resolve(loadedFile{name: "https://example.com/config.yaml", format: "yaml", data: []byte(data)}, nil)
+		if err == nil || !strings.Contains(err.Error(), "not supported in a remote config file") {
+			t.Errorf("include %s: got error %v, want the include rejected", include, err)
+		}
+	}
+
+	// an empty include is fine
+	_, _, err = resolve(loadedFile{name: "https://example.com/config.yaml", format: "yaml", data: []byte("include: []\n" + remoteSource)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
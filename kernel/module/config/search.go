@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// trace holds the lines of the last config file search
+var trace struct {
+	sync.Mutex
+	lines []string
+}
+
+// Trace returns the lines of the last config file search, explaining why each candidate was or wasn't picked
+func Trace() []string {
+	trace.Lock()
+	defer trace.Unlock()
+	return append([]string(nil), trace.lines...)
+}
+
+// searchPaths returns the directories searched for the config file, highest priority first,
+// Path is used if set, otherwise the paths are derived from AppName following the XDG Base Directory spec
+func (c *Config) searchPaths() []string {
+	if len(c.Path) > 0 {
+		paths := make([]string, 0, len(c.Path))
+		for _, path := range c.Path {
+			paths = append(paths, os.ExpandEnv(path))
+		}
+		return paths
+	}
+
+	// the etc directory of the working directory is kept for development
+	paths := []string{"etc"}
+
+	// user config, $XDG_CONFIG_HOME defaults to $HOME/.config
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			configHome = filepath.Join(home, ".config")
+		}
+	}
+	if configHome != "" {
+		paths = append(paths, filepath.Join(configHome, c.AppName))
+	}
+
+	// system config, $XDG_CONFIG_DIRS defaults to /etc/xdg
+	configDirs := os.Getenv("XDG_CONFIG_DIRS")
+	if configDirs == "" {
+		configDirs = "/etc/xdg"
+	}
+	for _, dir := range filepath.SplitList(configDirs) {
+		if dir != "" {
+			paths = append(paths, filepath.Join(dir, c.AppName))
+		}
+	}
+	return append(paths, filepath.Join("/etc", c.AppName))
+}
+
+// search returns the config files found in the search paths, highest priority first,
+// with Merge unset only the first one is returned
+func (c *Config) search() []string {
+	var (
+		found []string
+		lines []string
+	)
+	for _, path := range c.searchPaths() {
+		for _, ext := range c.Exts {
+			name := filepath.Join(path, c.Name+"."+ext)
+			info, err := os.Stat(name)
+			switch {
+			case os.IsNotExist(err):
+				lines = append(lines, fmt.Sprintf("%s: not found", name))
+				continue
+			case err != nil:
+				lines = append(lines, fmt.Sprintf("%s: %s", name, err))
+				continue
+			case !info.Mode().IsRegular():
+				lines = append(lines, fmt.Sprintf("%s: not a regular file", name))
+				continue
+			}
+
+			switch {
+			case len(found) == 0:
+				lines = append(lines, fmt.Sprintf("%s: selected", name))
+				found = append(found, name)
+			case c.Merge:
+				lines = append(lines, fmt.Sprintf("%s: merged beneath %s", name, found[len(found)-1]))
+				found = append(found, name)
+			default:
+				lines = append(lines, fmt.Sprintf("%s: ignored, %s takes precedence", name, found[0]))
+			}
+		}
+	}
+
+	trace.Lock()
+	trace.lines = lines
+	trace.Unlock()
+	return found
+}
+
+// find searches the config files, see search
+func (c *Config) find() ([]string, error) {
+	names := c.search()
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%w: %s.{%s} in %v", errNotFound, c.Name, strings.Join(c.Exts, ","), c.searchPaths())
+	}
+	return names, nil
+}
@@ -0,0 +1,250 @@
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Handler serves a control command, the result is encoded as JSON
+type Handler func(args []string) (any, error)
+
+// request and response are exchanged as a single JSON line each
+type request struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+type response struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+var (
+	mu       sync.RWMutex
+	handlers = make(map[string]Handler)
+	active   *Control
+)
+
+// Handle registers the handler of a control command, modules call it in Initialize
+func Handle(name string, h Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	handlers[name] = h
+}
+
+// Socket returns the path of the control socket, flags are taken into account once parsed
+func Socket() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if active == nil {
+		return ""
+	}
+	return os.ExpandEnv(active.Socket)
+}
+
+// Call sends a control command to the instance listening on the socket, an empty socket means Socket()
+func Call(path string, name string, args ...string) (json.RawMessage, error) {
+	if path == "" {
+		path = Socket()
+	}
+	conn, err := net.DialTimeout("unix", path, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	err = json.NewEncoder(conn).Encode(request{Command: name, Args: args})
+	if err != nil {
+		return nil, err
+	}
+	var resp response
+	err = json.NewDecoder(conn).Decode(&resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return resp.Result, errors.New(resp.Error)
+	}
+	return resp.Result, nil
+}
+
+// Control implement the Module interface, it serves the commands registered by Handle
+// on a unix socket only accessible by the current user
+type Control struct {
+	AddFlag         bool
+	AllowedCommands []string
+	AppName         string
+	// Socket defaults to $XDG_RUNTIME_DIR/<AppName>.sock, or <AppName>.sock in a directory
+	// of the temporary directory only accessible by the current user
+	Socket string
+}
+
+// privateDir returns the directory of the default socket when XDG_RUNTIME_DIR is not set
+func (c *Control) privateDir() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", c.AppName, os.Getuid()))
+}
+
+func (c *Control) Register(cmd *cobra.Command) {
+	if c.Socket == "" {
+		dir := os.Getenv("XDG_RUNTIME_DIR")
+		if dir == "" {
+			dir = c.privateDir()
+		}
+		c.Socket = filepath.Join(dir, c.AppName+".sock")
+	}
+	mu.Lock()
+	active = c
+	mu.Unlock()
+
+	if c.AddFlag {
+		cmd.PersistentFlags().StringVar(&c.Socket, "control-socket", c.Socket, "control socket path")
+	}
+}
+
+func (c *Control) MustCheck(*cobra.Command) {}
+
+func (c *Control) Initialize(cmd *cobra.Command) error {
+	// serve the long-running commands only
+	if !c.allow(cmd) {
+		return nil
+	}
+
+	path := os.ExpandEnv(c.Socket)
+	if filepath.Dir(path) == c.privateDir() {
+		err := mkdirPrivate(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+	}
+
+	// a socket left by a crashed instance is removed, a live one is kept and
+	// this instance runs without control socket
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		_ = conn.Close()
+		fmt.Fprintf(os.Stderr, "warning: control socket %s is in use by another instance, control commands are disabled\n", path)
+		return nil
+	}
+	_ = os.Remove(path)
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(path, 0600)
+	if err != nil {
+		_ = listener.Close()
+		return err
+	}
+	go serve(listener)
+	return nil
+}
+
+// mkdirPrivate creates a directory only accessible by the current user, an existing one must be too
+func mkdirPrivate(dir string) error {
+	err := os.Mkdir(dir, 0700)
+	if err != nil && !os.IsExist(err) {
+		return err
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("control socket directory %s is not a directory", dir)
+	}
+	if info.Mode().Perm() != 0700 {
+		// fails unless the directory belongs to the current user
+		err = os.Chmod(dir, 0700)
+		if err != nil {
+			return fmt.Errorf("control socket directory %s is accessible by other users: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+func (c *Control) allow(cmd *cobra.Command) bool {
+	for _, use := range c.AllowedCommands {
+		if use == cmd.Use {
+			return true
+		}
+	}
+	return false
+}
+
+func serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		go handle(conn)
+	}
+}
+
+func handle(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(time.Minute))
+
+	var (
+		req  request
+		resp response
+	)
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err == nil {
+		err = json.Unmarshal(line, &req)
+	}
+	if err == nil {
+		resp = call(req)
+	} else {
+		resp.Error = err.Error()
+	}
+	_ = json.NewEncoder(conn).Encode(resp)
+}
+
+// call runs a handler, a panic is reported to the client
+func call(req request) (resp response) {
+	mu.RLock()
+	h, ok := handlers[req.Command]
+	names := make([]string, 0, len(handlers))
+	for name := range handlers {
+		names = append(names, name)
+	}
+	mu.RUnlock()
+
+	if !ok {
+		sort.Strings(names)
+		resp.Error = fmt.Sprintf("unknown control command %q, supported commands: %s", req.Command, strings.Join(names, ","))
+		return resp
+	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			resp.Error = fmt.Sprintf("panic: %v", v)
+		}
+	}()
+	result, err := h(req.Args)
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	if result != nil {
+		resp.Result, err = json.Marshal(result)
+		if err != nil && resp.Error == "" {
+			resp.Error = err.Error()
+		}
+	}
+	return resp
+}
@@ -0,0 +1,230 @@
+package logger
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/vvfock3r/gooey/kernel/schema"
+)
+
+// Async is the buffered writing configuration of an output, decoded from settings.log.async
+type Async struct {
+	Enabled       bool            `mapstructure:"enabled"`
+	BufferSize    schema.ByteSize `mapstructure:"buffer_size"`
+	FlushInterval time.Duration   `mapstructure:"flush_interval"`
+	// Overflow is block or drop, a full buffer blocks the writes or drops the entries below error level
+	Overflow string `mapstructure:"overflow"`
+}
+
+// dropped are the entries dropped by the full buffers by output, kept across reloads
+var dropped = struct {
+	sync.Mutex
+	outputs map[string]*atomic.Uint64
+}{outputs: make(map[string]*atomic.Uint64)}
+
+func droppedCounter(output string) *atomic.Uint64 {
+	dropped.Lock()
+	defer dropped.Unlock()
+
+	n, ok := dropped.outputs[output]
+	if !ok {
+		n = new(atomic.Uint64)
+		dropped.outputs[output] = n
+	}
+	return n
+}
+
+// Dropped returns the number of entries dropped by each buffered output since the start
+func Dropped() map[string]uint64 {
+	dropped.Lock()
+	defer dropped.Unlock()
+
+	counts := make(map[string]uint64, len(dropped.outputs))
+	for output, n := range dropped.outputs {
+		counts[output] = n.Load()
+	}
+	return counts
+}
+
+// asyncWriter buffers the entries and writes them by a background goroutine,
+// every flush interval, when half of the buffer is used, and on Sync
+type asyncWriter struct {
+	out      zapcore.WriteSyncer
+	size     int
+	drop     bool
+	interval time.Duration
+	dropped  *atomic.Uint64
+
+	mu    sync.Mutex
+	space *sync.Cond
+	buf   []byte
+	spare []byte
+
+	// flushing serializes the writes to out
+	flushing sync.Mutex
+	wake     chan struct{}
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+func newAsyncWriter(out zapcore.WriteSyncer, output string, async Async) *asyncWriter {
+	w := &asyncWriter{
+		out:      out,
+		size:     int(async.BufferSize.Bytes()),
+		drop:     async.Overflow == "drop",
+		interval: async.FlushInterval,
+		dropped:  droppedCounter(output),
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	if w.interval <= 0 {
+		w.interval = time.Second
+	}
+	w.space = sync.NewCond(&w.mu)
+	w.buf = make([]byte, 0, w.size)
+	w.spare = make([]byte, 0, w.size)
+	go w.run()
+	return w
+}
+
+// Write copies the entry to the buffer, an entry larger than the buffer is buffered alone
+func (w *asyncWriter) Write(p []byte) (int, error) {
+	return w.write(p, w.drop)
+}
+
+// blocking returns the writer of the entries at error level and above, they are never dropped
+func (w *asyncWriter) blocking() zapcore.WriteSyncer {
+	return blockingWriter{w}
+}
+
+type blockingWriter struct {
+	*asyncWriter
+}
+
+func (w blockingWriter) Write(p []byte) (int, error) {
+	return w.write(p, false)
+}
+
+func (w *asyncWriter) write(p []byte, drop bool) (int, error) {
+	w.mu.Lock()
+	for len(w.buf) > 0 && len(w.buf)+len(p) > w.size {
+		if drop {
+			w.mu.Unlock()
+			w.dropped.Add(1)
+			return len(p), nil
+		}
+		w.notify()
+		w.space.Wait()
+	}
+	w.buf = append(w.buf, p...)
+	full := len(w.buf) >= w.size/2
+	w.mu.Unlock()
+
+	if full {
+		w.notify()
+	}
+	return len(p), nil
+}
+
+// Sync writes the buffered entries and syncs the output
+func (w *asyncWriter) Sync() error {
+	err := w.flush()
+	if err1 := w.out.Sync(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// close stops the background goroutine after writing the buffered entries
+func (w *asyncWriter) close() error {
+	close(w.done)
+	<-w.stopped
+	return w.flush()
+}
+
+func (w *asyncWriter) notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *asyncWriter) run() {
+	defer close(w.stopped)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+		_ = w.flush()
+	}
+}
+
+// flush swaps the buffers and writes the full one, the writes are not blocked meanwhile
+func (w *asyncWriter) flush() error {
+	w.flushing.Lock()
+	defer w.flushing.Unlock()
+
+	w.mu.Lock()
+	data := w.buf
+	w.buf, w.spare = w.spare[:0], nil
+	w.mu.Unlock()
+
+	var err error
+	if len(data) > 0 {
+		_, err = w.out.Write(data)
+	}
+
+	w.mu.Lock()
+	w.spare = data[:0]
+	w.space.Broadcast()
+	w.mu.Unlock()
+	return err
+}
+
+// Sync writes the buffered entries of all the outputs and the summaries of the rate limited ones,
+// call it before exiting the process, the fatal level and the shutdown signals flush them automatically
+func Sync() error {
+	if lim := current.Load().limiter; lim != nil {
+		lim.report(time.Now(), true)
+	}
+	return DefaultLogger.Sync()
+}
+
+var shutdownOnce sync.Once
+
+// handleShutdownSignals flushes the buffered entries on the signals and raises them again,
+// so the process exits as it would without the handler
+func handleShutdownSignals(signals []os.Signal) {
+	if len(signals) == 0 {
+		return
+	}
+	shutdownOnce.Do(func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, signals...)
+		go func() {
+			sig := <-ch
+			_ = Sync()
+			signal.Stop(ch)
+
+			p, err := os.FindProcess(os.Getpid())
+			if err == nil {
+				err = p.Signal(sig)
+			}
+			if err != nil {
+				os.Exit(1)
+			}
+		}()
+	})
+}
@@ -0,0 +1,116 @@
+package logger
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// gatedWriter blocks the writes until release is closed, entered is closed by the first write
+type gatedWriter struct {
+	entered chan struct{}
+	release chan struct{}
+	once    sync.Once
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *gatedWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { close(w.entered) })
+	<-w.release
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *gatedWriter) Sync() error {
+	return nil
+}
+
+// TestAsyncDropKeepsErrors blocks the output of a small dropping buffer until it overflows,
+// the entries below error level are dropped and the ones at error level wait for space
+func TestAsyncDropKeepsErrors(t *testing.T) {
+	out := &gatedWriter{entered: make(chan struct{}), release: make(chan struct{})}
+	console := stdout
+	stdout = out
+	t.Cleanup(func() {
+		stdout = console
+		s, err := defaultLogConfig.build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		swap(s)
+	})
+
+	config := &LogConfig{
+		Level:  "info",
+		Format: "json",
+		Output: "stdout",
+		Async:  Async{Enabled: true, BufferSize: 256, FlushInterval: time.Hour, Overflow: "drop"},
+	}
+	s, err := config.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	swap(s)
+	before := Dropped()["stdout"]
+
+	// half of the buffer used wakes the flush, which blocks in the output
+	written := 0
+	for ; written < 4; written++ {
+		DefaultLogger.Info("filler", zap.Int("i", written))
+	}
+	select {
+	case <-out.entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the buffer is not flushed")
+	}
+
+	// the buffer fills up while the output is blocked
+	for ; written < 100; written++ {
+		DefaultLogger.Info("filler", zap.Int("i", written))
+	}
+	dropped := Dropped()["stdout"] - before
+	if dropped == 0 {
+		t.Fatal("no entry was dropped by the full buffer")
+	}
+
+	const errors = 20
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < errors; i++ {
+			DefaultLogger.Error("critical", zap.Int("i", i))
+		}
+	}()
+	select {
+	case <-done:
+		t.Fatal("error entries were not blocked by the full buffer")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(out.release)
+	<-done
+	err = Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out.mu.Lock()
+	data := out.buf.Bytes()
+	out.mu.Unlock()
+	if n := bytes.Count(data, []byte(`"critical"`)); n != errors {
+		t.Errorf("got %d error entries, want %d", n, errors)
+	}
+	if n := bytes.Count(data, []byte(`"filler"`)); uint64(n)+dropped != uint64(written) {
+		t.Errorf("got %d entries written and %d dropped, want %d in total", n, dropped, written)
+	}
+	if got := Dropped()["stdout"] - before; got != dropped {
+		t.Errorf("%d entries dropped after the output was released, want none", got-dropped)
+	}
+}
@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vvfock3r/gooey/kernel/module/control"
+)
+
+func (l *Logger) command() *cobra.Command {
+	var (
+		ttl    string
+		socket string
+	)
+	cmd := &cobra.Command{
+		Use:   "log-level [level|reset]",
+		Short: "Show or change the log level of a running instance",
+		Long: "Show or change the log level of a running instance through its control socket\n" +
+			"The level overrides settings.log.level and the level of every output until reset or the ttl expires",
+		Args: cobra.MaximumNArgs(1),
+		// the running instance is changed, the modules of this process are not initialized
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if ttl != "" {
+				if len(args) == 0 || args[0] == "reset" {
+					return fmt.Errorf("--ttl requires a level")
+				}
+				args = append(args, ttl)
+			}
+			result, err := control.Call(socket, "log-level", args...)
+			if err != nil {
+				return err
+			}
+			var status LevelStatus
+			err = json.Unmarshal(result, &status)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("level: %s\n", status.Level)
+			fmt.Printf("configured: %s\n", status.Configured)
+			if status.Overridden && !status.Expires.IsZero() {
+				fmt.Printf("expires: %s\n", status.Expires.Local().Format(time.DateTime))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&ttl, "ttl", "", "restore the configured level after the duration, such as 30m")
+	cmd.Flags().StringVar(&socket, "socket", "", "control socket of the instance, defaults to --control-socket")
+	return cmd
+}
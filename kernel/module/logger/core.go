@@ -0,0 +1,170 @@
+package logger
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// state is the outputs of the logger built from a configuration, it is replaced on reload
+type state struct {
+	cores      []*levelCore
+	files      []stateFile
+	asyncs     []*asyncWriter
+	limiter    *limiter
+	stacktrace zapcore.LevelEnabler
+
+	// writes hold the read lock, closing waits for them
+	mu     sync.RWMutex
+	closed bool
+}
+
+// stateFile is a file output of a state, the files are shared between states,
+// so the rotation of a state is applied when it becomes current
+type stateFile struct {
+	*rotator
+	rotation Rotation
+}
+
+// current is the state written by DefaultLogger and all the loggers derived from it
+var current atomic.Pointer[state]
+
+// swap makes s the current state and closes the previous one once its in-flight writes finished,
+// the files no longer written by s are closed
+func swap(s *state) {
+	for _, file := range s.files {
+		file.setRotation(file.rotation)
+	}
+
+	old := current.Swap(s)
+	if old == nil {
+		return
+	}
+
+	old.mu.Lock()
+	old.closed = true
+	old.mu.Unlock()
+
+	for _, core := range old.cores {
+		_ = core.Sync()
+	}
+	old.release()
+}
+
+// release releases the buffers and files of a state that is discarded or replaced
+func (s *state) release() {
+	if s.limiter != nil {
+		s.limiter.stop()
+	}
+	for _, async := range s.asyncs {
+		_ = async.close()
+	}
+	for _, file := range s.files {
+		_ = file.release()
+	}
+}
+
+// stacktraceLevel adds stack traces at the levels of Logger.Stacktrace
+type stacktraceLevel struct{}
+
+func (stacktraceLevel) Enabled(l zapcore.Level) bool {
+	enabler := current.Load().stacktrace
+	return enabler != nil && enabler.Enabled(l)
+}
+
+// swapCore delegates to the current state, so the loggers handed out by DefaultLogger, Named
+// or With stay valid across reloads, fields added by With are applied to each new state
+type swapCore struct {
+	fields []zapcore.Field
+	cache  atomic.Pointer[fieldCores]
+}
+
+// fieldCores are the cores of a state with the fields of a swapCore
+type fieldCores struct {
+	state *state
+	cores []*levelCore
+}
+
+func (c *swapCore) cores(s *state) []*levelCore {
+	if len(c.fields) == 0 {
+		return s.cores
+	}
+	if cached := c.cache.Load(); cached != nil && cached.state == s {
+		return cached.cores
+	}
+	cores := make([]*levelCore, len(s.cores))
+	for i, core := range s.cores {
+		cores[i] = core.with(c.fields)
+	}
+	c.cache.Store(&fieldCores{state: s, cores: cores})
+	return cores
+}
+
+func (c *swapCore) Enabled(l zapcore.Level) bool {
+	for _, core := range current.Load().cores {
+		if core.Enabled(l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *swapCore) Level() zapcore.Level {
+	return zapcore.LevelOf(zap.LevelEnablerFunc(c.Enabled))
+}
+
+func (c *swapCore) With(fields []zapcore.Field) zapcore.Core {
+	all := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	all = append(all, c.fields...)
+	all = append(all, fields...)
+	return &swapCore{fields: all}
+}
+
+func (c *swapCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	s := current.Load()
+	for _, core := range s.cores {
+		if core.enabled(ent) {
+			if s.limiter != nil && !s.limiter.allow(ent) {
+				return ce
+			}
+			return ce.AddCore(ent, c)
+		}
+	}
+	return ce
+}
+
+// Write writes the entry to the outputs of the current state enabling it,
+// an entry checked before a swap is written to the new state
+func (c *swapCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	for {
+		s := current.Load()
+		s.mu.RLock()
+		if s.closed {
+			s.mu.RUnlock()
+			continue
+		}
+		var errs []error
+		for _, core := range c.cores(s) {
+			if core.enabled(ent) {
+				errs = append(errs, core.Write(ent, fields))
+			}
+		}
+		s.mu.RUnlock()
+		return errors.Join(errs...)
+	}
+}
+
+func (c *swapCore) Sync() error {
+	s := current.Load()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var errs []error
+	for _, core := range s.cores {
+		errs = append(errs, core.Sync())
+	}
+	return errors.Join(errs...)
+}
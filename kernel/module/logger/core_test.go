@@ -0,0 +1,107 @@
+package logger
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// TestSwapConcurrentWrites swaps the outputs between two files while loggers write them,
+// run it with -race, a file closed before the writes in flight would lose entries
+func TestSwapConcurrentWrites(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log")}
+	t.Cleanup(func() {
+		s, err := defaultLogConfig.build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		swap(s)
+	})
+
+	build := func(i int) *state {
+		config := &LogConfig{Level: "info", Format: "json", Output: files[i%len(files)], addCaller: true}
+		s, err := config.build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	swap(build(0))
+
+	loggers := []*zap.Logger{
+		DefaultLogger,
+		DefaultLogger.With(zap.String("with", "field")),
+		Named("race"),
+		Named("race.child").With(zap.Int("n", 1)),
+	}
+	const perWriter = 2000
+
+	var (
+		wg      sync.WaitGroup
+		done    = make(chan struct{})
+		written atomic.Int64
+	)
+	for _, l := range loggers {
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func(l *zap.Logger) {
+				defer wg.Done()
+				for j := 0; j < perWriter; j++ {
+					l.Info("entry", zap.Int("j", j))
+					written.Add(1)
+				}
+			}(l)
+		}
+	}
+
+	swapped := make(chan int)
+	go func() {
+		n := 0
+		defer func() { swapped <- n }()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			n++
+			swap(build(n))
+		}
+	}()
+	wg.Wait()
+	close(done)
+	if n := <-swapped; n == 0 {
+		t.Fatal("no swap happened while writing")
+	}
+
+	// swapping to the console closes both files
+	s, err := defaultLogConfig.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	swap(s)
+	rotators.Lock()
+	open := len(rotators.files)
+	rotators.Unlock()
+	if open != 0 {
+		t.Errorf("%d files are still open after the last swap", open)
+	}
+
+	var lines int
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines += bytes.Count(data, []byte("\n"))
+	}
+	if want := int(written.Load()); lines != want {
+		t.Errorf("got %d entries in the files, want %d", lines, want)
+	}
+}
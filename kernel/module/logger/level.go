@@ -0,0 +1,261 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/vvfock3r/gooey/kernel/schema"
+)
+
+// level is the level of the logger, kept across reloads so a level set at runtime is not lost,
+// it is settings.log.level unless overridden by SetLevel
+var level = struct {
+	sync.Mutex
+	atomic     zap.AtomicLevel
+	configured zapcore.Level
+	overridden atomic.Bool
+	expires    time.Time
+	timer      *time.Timer
+}{atomic: zap.NewAtomicLevelAt(zapcore.InfoLevel), configured: zapcore.InfoLevel}
+
+// LevelStatus is the level of the logger reported by the log-level control command
+type LevelStatus struct {
+	Level      string    `json:"level"`
+	Configured string    `json:"configured"`
+	Overridden bool      `json:"overridden"`
+	Expires    time.Time `json:"expires,omitempty"`
+}
+
+// Level returns the current level of the logger
+func Level() zapcore.Level {
+	return level.atomic.Level()
+}
+
+// SetLevel overrides the level of the logger and of every output until ResetLevel is called,
+// a positive ttl resets it automatically, reloading the configuration keeps the override
+func SetLevel(l zapcore.Level, ttl time.Duration) {
+	level.Lock()
+	defer level.Unlock()
+
+	if level.timer != nil {
+		level.timer.Stop()
+		level.timer = nil
+	}
+	level.expires = time.Time{}
+	if ttl > 0 {
+		level.expires = time.Now().Add(ttl)
+		var timer *time.Timer
+		timer = time.AfterFunc(ttl, func() {
+			level.Lock()
+			defer level.Unlock()
+			// replaced by a later call
+			if level.timer != timer {
+				return
+			}
+			resetLevel("ttl expired")
+		})
+		level.timer = timer
+	}
+	level.overridden.Store(true)
+	level.atomic.SetLevel(l)
+	Info("log level overridden", zap.Stringer("level", l), zap.Duration("ttl", ttl))
+}
+
+// ResetLevel restores settings.log.level after SetLevel
+func ResetLevel() {
+	level.Lock()
+	defer level.Unlock()
+	resetLevel("reset")
+}
+
+func resetLevel(reason string) {
+	if level.timer != nil {
+		level.timer.Stop()
+		level.timer = nil
+	}
+	if !level.overridden.Load() {
+		return
+	}
+	Info("log level restored", zap.Stringer("level", level.configured), zap.String("reason", reason))
+	level.expires = time.Time{}
+	level.overridden.Store(false)
+	level.atomic.SetLevel(level.configured)
+}
+
+// setConfiguredLevel applies settings.log.level, an override stays active
+func setConfiguredLevel(l zapcore.Level) {
+	level.Lock()
+	defer level.Unlock()
+
+	level.configured = l
+	if !level.overridden.Load() {
+		level.atomic.SetLevel(l)
+	}
+}
+
+func levelStatus() LevelStatus {
+	level.Lock()
+	defer level.Unlock()
+	return LevelStatus{
+		Level:      level.atomic.Level().String(),
+		Configured: level.configured.String(),
+		Overridden: level.overridden.Load(),
+		Expires:    level.expires,
+	}
+}
+
+// names are the levels of the named loggers from settings.log.levels, a name without a level
+// uses the level of its parent, such as mysql for mysql.driver, and then the level of the logger
+var names atomic.Pointer[nameLevels]
+
+type nameLevels struct {
+	levels map[string]zapcore.Level
+	min    zapcore.Level
+}
+
+func setNameLevels(levels map[string]zapcore.Level) {
+	n := &nameLevels{levels: levels, min: zapcore.InvalidLevel}
+	for _, l := range levels {
+		if n.min == zapcore.InvalidLevel || l < n.min {
+			n.min = l
+		}
+	}
+	names.Store(n)
+}
+
+// nameLevel returns the level of a named logger
+func nameLevel(name string) zapcore.Level {
+	if n := names.Load(); n != nil && !level.overridden.Load() {
+		if l, ok := lookupName(n.levels, name); ok {
+			return l
+		}
+	}
+	return level.atomic.Level()
+}
+
+// lookupName returns the value of a named logger, falling back to the parent names
+func lookupName[T any](values map[string]T, name string) (T, bool) {
+	for name != "" && len(values) > 0 {
+		if v, ok := values[name]; ok {
+			return v, true
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	var zero T
+	return zero, false
+}
+
+// levelCore filters the entries of an output by level, an output without its own level follows
+// the level of the named logger, every output follows the logger while its level is overridden
+type levelCore struct {
+	zapcore.Core
+	// critical writes the entries at error level and above to a buffer dropping the others when full
+	critical zapcore.Core
+	own      zapcore.Level
+	inherit  bool
+}
+
+func (c *levelCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if c.critical != nil && ent.Level >= zapcore.ErrorLevel {
+		return c.critical.Write(ent, fields)
+	}
+	return c.Core.Write(ent, fields)
+}
+
+// Enabled reports whether the level is enabled for any named logger, enabled filters by name
+func (c *levelCore) Enabled(l zapcore.Level) bool {
+	if level.overridden.Load() {
+		return level.atomic.Enabled(l)
+	}
+	if !c.inherit {
+		return c.own.Enabled(l)
+	}
+	if level.atomic.Enabled(l) {
+		return true
+	}
+	n := names.Load()
+	return n != nil && len(n.levels) > 0 && n.min.Enabled(l)
+}
+
+func (c *levelCore) with(fields []zapcore.Field) *levelCore {
+	core := &levelCore{Core: c.Core.With(fields), own: c.own, inherit: c.inherit}
+	if c.critical != nil {
+		core.critical = c.critical.With(fields)
+	}
+	return core
+}
+
+// enabled reports whether the entry is written to the output
+func (c *levelCore) enabled(ent zapcore.Entry) bool {
+	if c.inherit && !level.overridden.Load() {
+		return nameLevel(ent.LoggerName).Enabled(ent.Level)
+	}
+	return c.Enabled(ent.Level)
+}
+
+// Named returns a child logger of DefaultLogger, its level is set by settings.log.levels
+func Named(name string) *zap.Logger {
+	// the package functions skip one more caller
+	return DefaultLogger.Named(name).WithOptions(zap.AddCallerSkip(-1))
+}
+
+// handleLevel serves the log-level control command: no argument reports the level,
+// "reset" restores settings.log.level, otherwise a level and an optional ttl are set
+func handleLevel(args []string) (any, error) {
+	switch {
+	case len(args) == 0:
+	case len(args) == 1 && args[0] == "reset":
+		ResetLevel()
+	case len(args) <= 2:
+		l, err := zapcore.ParseLevel(args[0])
+		if err != nil {
+			return nil, err
+		}
+		var ttl time.Duration
+		if len(args) == 2 {
+			ttl, err = schema.ParseDuration(args[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		SetLevel(l, ttl)
+	default:
+		return nil, fmt.Errorf("usage: log-level [level [ttl] | reset]")
+	}
+	return levelStatus(), nil
+}
+
+var levelOnce sync.Once
+
+// handleLevelSignal toggles the debug level on sig, a positive ttl resets it automatically,
+// a nil signal disables it
+func handleLevelSignal(sig os.Signal, ttl time.Duration) {
+	if sig == nil {
+		return
+	}
+	levelOnce.Do(func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, sig)
+		go func() {
+			for range ch {
+				if level.overridden.Load() {
+					ResetLevel()
+					continue
+				}
+				SetLevel(zapcore.DebugLevel, ttl)
+			}
+		}()
+	})
+}
@@ -0,0 +1,343 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/vvfock3r/gooey/kernel/schema"
+)
+
+// limiterKeys is the number of messages counted separately by the sampler and the rate limiter,
+// beyond it the new messages of a level and logger are counted together until the counted ones expire
+const limiterKeys = 4096
+
+// Sampling is the sampling configuration, decoded from settings.log.sampling, within each tick
+// the first Initial entries with the same level, logger name and message are logged,
+// then every Thereafter-th entry
+type Sampling struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Initial    int           `mapstructure:"initial"`
+	Thereafter int           `mapstructure:"thereafter"`
+	Tick       time.Duration `mapstructure:"tick"`
+	// Loggers overrides the sampling of the named loggers
+	Loggers map[string]any `mapstructure:"loggers"`
+}
+
+// RateLimit is the rate limiting configuration, decoded from settings.log.rate_limit, within each
+// interval at most Limit entries with the same level, logger name and message are logged,
+// the suppressed ones are reported by a summary entry once the interval is over
+type RateLimit struct {
+	Limit    int           `mapstructure:"limit"`
+	Interval time.Duration `mapstructure:"interval"`
+	// Loggers overrides the rate limiting of the named loggers
+	Loggers map[string]any `mapstructure:"loggers"`
+}
+
+// rules are the sampling and rate limiting of a named logger
+type rules struct {
+	sampling Sampling
+	rate     RateLimit
+}
+
+// limiter samples and rate limits the entries of a state, levels above error are always logged
+type limiter struct {
+	global rules
+	named  map[string]*rules
+	cache  sync.Map
+
+	// mu guards the map, the entries count on their own and are removed by report only
+	mu      sync.RWMutex
+	entries map[limitKey]*limitEntry
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// limiter returns nil if neither sampling nor rate limiting is enabled for any logger
+func (l *LogConfig) limiter() (*limiter, error) {
+	err := checkLimits(defaultSamplingKey, defaultRateLimitKey, l.Sampling, l.RateLimit)
+	if err != nil {
+		return nil, err
+	}
+	lim := &limiter{
+		global: rules{sampling: l.Sampling, rate: l.RateLimit},
+		named:  make(map[string]*rules),
+	}
+
+	// the named loggers inherit the settings they do not override
+	enabled := l.Sampling.Enabled || l.RateLimit.Limit > 0
+	for name, item := range l.Sampling.Loggers {
+		r := lim.rule(strings.ToLower(name))
+		err = schema.Decode(item, &r.sampling)
+		if err != nil {
+			return nil, fmt.Errorf("%s.loggers.%s: %w", defaultSamplingKey, name, err)
+		}
+		enabled = enabled || r.sampling.Enabled
+	}
+	for name, item := range l.RateLimit.Loggers {
+		r := lim.rule(strings.ToLower(name))
+		err = schema.Decode(item, &r.rate)
+		if err != nil {
+			return nil, fmt.Errorf("%s.loggers.%s: %w", defaultRateLimitKey, name, err)
+		}
+		enabled = enabled || r.rate.Limit > 0
+	}
+	for name, r := range lim.named {
+		err = checkLimits(defaultSamplingKey+".loggers."+name, defaultRateLimitKey+".loggers."+name, r.sampling, r.rate)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !enabled {
+		return nil, nil
+	}
+
+	lim.entries = make(map[limitKey]*limitEntry)
+	lim.done = make(chan struct{})
+	lim.stopped = make(chan struct{})
+	go lim.run()
+	return lim, nil
+}
+
+func checkLimits(samplingKey, rateKey string, sampling Sampling, rate RateLimit) error {
+	if sampling.Enabled && (sampling.Initial < 0 || sampling.Thereafter < 0 || sampling.Tick <= 0) {
+		return fmt.Errorf("%s: initial and thereafter must not be negative and tick must be positive", samplingKey)
+	}
+	if rate.Limit > 0 && rate.Interval <= 0 {
+		return fmt.Errorf("%s: interval must be positive", rateKey)
+	}
+	return nil
+}
+
+// rule returns the rules of a name configured in the loggers of sampling or rate_limit
+func (lim *limiter) rule(name string) *rules {
+	r, ok := lim.named[name]
+	if !ok {
+		r = &rules{sampling: lim.global.sampling, rate: lim.global.rate}
+		lim.named[name] = r
+	}
+	return r
+}
+
+// rules returns the rules of a named logger, falling back to the parent names and the global rules
+func (lim *limiter) rules(name string) *rules {
+	if r, ok := lim.cache.Load(name); ok {
+		return r.(*rules)
+	}
+	r, ok := lookupName(lim.named, name)
+	if !ok {
+		r = &lim.global
+	}
+	lim.cache.Store(name, r)
+	return r
+}
+
+// allow reports whether the entry is logged
+func (lim *limiter) allow(ent zapcore.Entry) bool {
+	if ent.Level > zapcore.ErrorLevel {
+		return true
+	}
+	r := lim.rules(ent.LoggerName)
+	if !r.sampling.Enabled && r.rate.Limit <= 0 {
+		return true
+	}
+
+	key := limitKey{level: ent.Level, name: ent.LoggerName, message: ent.Message}
+	lim.mu.RLock()
+	e := lim.entries[key]
+	for e == nil {
+		lim.mu.RUnlock()
+		key = lim.add(key)
+		lim.mu.RLock()
+		e = lim.entries[key]
+	}
+
+	var (
+		allowed = true
+		summary suppressed
+		ok      bool
+	)
+	if r.sampling.Enabled {
+		n := e.counter.inc(ent.Time, r.sampling.Tick)
+		initial, thereafter := uint64(r.sampling.Initial), uint64(r.sampling.Thereafter)
+		allowed = n <= initial || thereafter != 0 && (n-initial)%thereafter == 0
+	}
+	if allowed && r.rate.Limit > 0 {
+		allowed, summary, ok = e.slot.allow(ent, r.rate)
+	}
+	lim.mu.RUnlock()
+
+	// the summary of the previous interval is written before the entry
+	if ok {
+		summary.write()
+	}
+	return allowed
+}
+
+// limitKey identifies the entries counted together
+type limitKey struct {
+	level   zapcore.Level
+	name    string
+	message string
+}
+
+// limitEntry counts the entries of a key for the sampler and the rate limiter
+type limitEntry struct {
+	counter counter
+	slot    slot
+}
+
+// add adds the entry of key and returns the key it is counted under,
+// the overflow key of its level and logger once limiterKeys messages are counted
+func (lim *limiter) add(key limitKey) limitKey {
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+
+	if _, ok := lim.entries[key]; ok {
+		return key
+	}
+	if len(lim.entries) >= limiterKeys {
+		key.message = ""
+		if _, ok := lim.entries[key]; ok {
+			return key
+		}
+	}
+	lim.entries[key] = &limitEntry{}
+	return key
+}
+
+// run reports the suppressed entries of the slots whose interval is over
+func (lim *limiter) run() {
+	defer close(lim.stopped)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lim.done:
+			return
+		case now := <-ticker.C:
+			lim.report(now, false)
+		}
+	}
+}
+
+// report writes the summaries of the slots whose interval is over, or of every slot if all is set,
+// and removes the entries whose tick and interval are over
+func (lim *limiter) report(now time.Time, all bool) {
+	var summaries []suppressed
+	lim.mu.Lock()
+	for key, e := range lim.entries {
+		s := &e.slot
+		s.mu.Lock()
+		summary, ok := s.summary(now, all)
+		idle := s.count == 0
+		s.mu.Unlock()
+		if ok {
+			summaries = append(summaries, summary)
+		}
+		if idle && e.counter.resetAt.Load() <= now.UnixNano() {
+			delete(lim.entries, key)
+		}
+	}
+	lim.mu.Unlock()
+
+	for _, summary := range summaries {
+		summary.write()
+	}
+}
+
+// stop stops the background goroutine and reports all the suppressed entries
+func (lim *limiter) stop() {
+	close(lim.done)
+	<-lim.stopped
+	lim.report(time.Now(), true)
+}
+
+// counter counts the entries of a slot within a tick
+type counter struct {
+	resetAt atomic.Int64
+	count   atomic.Uint64
+}
+
+func (c *counter) inc(t time.Time, tick time.Duration) uint64 {
+	now := t.UnixNano()
+	resetAt := c.resetAt.Load()
+	if resetAt > now {
+		return c.count.Add(1)
+	}
+
+	c.count.Store(1)
+	if !c.resetAt.CompareAndSwap(resetAt, now+tick.Nanoseconds()) {
+		// reset by another goroutine
+		return c.count.Add(1)
+	}
+	return 1
+}
+
+// slot counts the entries of a key within an interval, the messages sharing the overflow key
+// of their level and logger are counted together and reported under the first message of the interval
+type slot struct {
+	mu         sync.Mutex
+	level      zapcore.Level
+	name       string
+	message    string
+	start      time.Time
+	interval   time.Duration
+	count      int
+	suppressed int
+}
+
+// suppressed is the summary of the entries suppressed in an interval
+type suppressed struct {
+	level   zapcore.Level
+	name    string
+	message string
+	count   int
+}
+
+// allow reports whether the entry is logged, and returns the summary of the previous interval to be written first
+func (s *slot) allow(ent zapcore.Entry, rate RateLimit) (bool, suppressed, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summary, ok := s.summary(ent.Time, false)
+	if s.count == 0 {
+		s.level, s.name, s.message = ent.Level, ent.LoggerName, ent.Message
+		s.start, s.interval = ent.Time, rate.Interval
+	}
+	s.count++
+	allowed := s.count <= rate.Limit
+	if !allowed {
+		s.suppressed++
+	}
+	return allowed, summary, ok
+}
+
+// summary resets the slot once its interval is over, or if reset is set,
+// and returns the entries it suppressed
+func (s *slot) summary(now time.Time, reset bool) (suppressed, bool) {
+	if s.count == 0 || !reset && now.Sub(s.start) < s.interval {
+		return suppressed{}, false
+	}
+	summary := suppressed{level: s.level, name: s.name, message: s.message, count: s.suppressed}
+	s.count, s.suppressed = 0, 0
+	return summary, summary.count > 0
+}
+
+// write writes the summary to the current outputs, bypassing sampling and rate limiting
+func (s suppressed) write() {
+	ent := zapcore.Entry{
+		Level:      s.level,
+		LoggerName: s.name,
+		Time:       time.Now(),
+		Message:    fmt.Sprintf("suppressed %d similar messages", s.count),
+	}
+	_ = (&swapCore{}).Write(ent, []zapcore.Field{zap.String("similar", s.message), zap.Int("suppressed", s.count)})
+}
@@ -0,0 +1,128 @@
+package logger
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// newTestLimiter returns a limiter without the background goroutine reporting the summaries
+func newTestLimiter(r rules) *limiter {
+	return &limiter{global: r, named: make(map[string]*rules), entries: make(map[limitKey]*limitEntry)}
+}
+
+func TestLimiterSampling(t *testing.T) {
+	lim := newTestLimiter(rules{sampling: Sampling{Enabled: true, Initial: 2, Thereafter: 3, Tick: time.Minute}})
+	start := time.Now()
+
+	// the first 2 entries of each message, then every 3rd
+	allowed := map[string][]int{}
+	for i := 1; i <= 10; i++ {
+		for _, message := range []string{"a", "b"} {
+			ent := zapcore.Entry{Level: zapcore.InfoLevel, Message: message, Time: start}
+			if lim.allow(ent) {
+				allowed[message] = append(allowed[message], i)
+			}
+		}
+	}
+	want := []int{1, 2, 5, 8}
+	for _, message := range []string{"a", "b"} {
+		if fmt.Sprint(allowed[message]) != fmt.Sprint(want) {
+			t.Errorf("message %s: got entries %v allowed, want %v", message, allowed[message], want)
+		}
+	}
+
+	// the same message at another level or in another logger is counted apart
+	for _, ent := range []zapcore.Entry{
+		{Level: zapcore.WarnLevel, Message: "a", Time: start},
+		{Level: zapcore.InfoLevel, LoggerName: "mysql", Message: "a", Time: start},
+	} {
+		if !lim.allow(ent) {
+			t.Errorf("entry %+v is sampled with the others", ent)
+		}
+	}
+
+	// the counters restart with the next tick
+	if !lim.allow(zapcore.Entry{Level: zapcore.InfoLevel, Message: "a", Time: start.Add(time.Minute)}) {
+		t.Error("the first entry of the next tick is sampled")
+	}
+
+	// errors above error level are never sampled
+	for i := 0; i < 10; i++ {
+		if !lim.allow(zapcore.Entry{Level: zapcore.DPanicLevel, Message: "a", Time: start}) {
+			t.Fatal("an entry above error level is sampled")
+		}
+	}
+}
+
+func TestLimiterRateByMessage(t *testing.T) {
+	rate := RateLimit{Limit: 2, Interval: time.Minute}
+	lim := newTestLimiter(rules{rate: rate})
+	start := time.Now()
+
+	allowed := map[string]int{}
+	for i := 0; i < 10; i++ {
+		for _, message := range []string{"a", "b"} {
+			if lim.allow(zapcore.Entry{Level: zapcore.InfoLevel, Message: message, Time: start}) {
+				allowed[message]++
+			}
+		}
+	}
+	if allowed["a"] != rate.Limit || allowed["b"] != rate.Limit {
+		t.Errorf("got %v entries allowed, want %d of each message", allowed, rate.Limit)
+	}
+
+	// the expired entries are reported and removed
+	lim.report(start.Add(rate.Interval), false)
+	if n := len(lim.entries); n != 0 {
+		t.Errorf("%d entries are kept after their interval", n)
+	}
+}
+
+func TestLimiterOverflow(t *testing.T) {
+	lim := newTestLimiter(rules{rate: RateLimit{Limit: 1, Interval: time.Minute}})
+	start := time.Now()
+	for i := 0; i < limiterKeys; i++ {
+		lim.allow(zapcore.Entry{Level: zapcore.InfoLevel, Message: fmt.Sprint(i), Time: start})
+	}
+
+	// the messages beyond limiterKeys share the overflow key of their level and logger
+	if !lim.allow(zapcore.Entry{Level: zapcore.InfoLevel, Message: "x", Time: start}) {
+		t.Error("the first overflowing message is limited")
+	}
+	if lim.allow(zapcore.Entry{Level: zapcore.InfoLevel, Message: "y", Time: start}) {
+		t.Error("the overflowing messages are not limited together")
+	}
+	if n := len(lim.entries); n != limiterKeys+1 {
+		t.Errorf("got %d entries, want %d", n, limiterKeys+1)
+	}
+}
+
+// TestSlotSharedMessages alternates two messages in one slot, as the overflowing messages do,
+// they are limited together instead of resetting each other
+func TestSlotSharedMessages(t *testing.T) {
+	var s slot
+	rate := RateLimit{Limit: 3, Interval: time.Minute}
+	start := time.Now()
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		ent := zapcore.Entry{Level: zapcore.InfoLevel, Message: "a", Time: start.Add(time.Duration(i) * time.Second)}
+		if i%2 == 1 {
+			ent.Message = "b"
+		}
+		if ok, _, _ := s.allow(ent, rate); ok {
+			allowed++
+		}
+	}
+	if allowed != rate.Limit {
+		t.Errorf("got %d entries allowed, want %d", allowed, rate.Limit)
+	}
+
+	summary, ok := s.summary(start.Add(rate.Interval), false)
+	if !ok || summary.count != 10-rate.Limit || summary.message != "a" {
+		t.Errorf("got summary %+v %v, want %d suppressed under the first message", summary, ok, 10-rate.Limit)
+	}
+}
@@ -4,16 +4,28 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+
+	"github.com/vvfock3r/gooey/kernel/iface"
+	"github.com/vvfock3r/gooey/kernel/module/control"
+	"github.com/vvfock3r/gooey/kernel/schema"
+	"github.com/vvfock3r/gooey/kernel/snapshot"
 )
 
-// default logger
-var DefaultLogger, _ = defaultLogConfig.build()
+// default logger, it is never replaced, a reload swaps the outputs it writes,
+// so the loggers derived from it by Named or With stay valid
+var DefaultLogger = zap.New(&swapCore{}, zap.AddCaller(), zap.AddCallerSkip(1), zap.AddStacktrace(stacktraceLevel{}))
+
+func init() {
+	s, _ := defaultLogConfig.build()
+	current.Store(s)
+}
 
 var defaultLogConfig = &LogConfig{
 	Level:     "info",
@@ -27,14 +39,214 @@ type Logger struct {
 	AddFlag    bool
 	AddCaller  bool
 	Stacktrace zapcore.LevelEnabler
+	// ReopenSignal reopens the file outputs, see Reopen, defaults to SIGUSR1
+	ReopenSignal os.Signal
+	// LevelSignal toggles the debug level, see SetLevel, defaults to SIGUSR2
+	LevelSignal os.Signal
+	// LevelSignalTTL resets the debug level toggled by LevelSignal after the duration, 0 never resets it
+	LevelSignalTTL time.Duration
+	// ShutdownSignals flush the buffered entries before the process exits, defaults to SIGINT and SIGTERM,
+	// set it to an empty slice if the application handles them and calls Sync itself
+	ShutdownSignals []os.Signal
+}
+
+var (
+	defaultLogLevelKey  = "settings.log.level"
+	defaultLogFormatKey = "settings.log.format"
+	defaultLogOutputKey = "settings.log.output"
+
+	defaultLogOutputsKey = "settings.log.outputs"
+	defaultLogLevelsKey  = "settings.log.levels"
+
+	defaultRotationMaxSizeKey    = "settings.log.rotation.max_size"
+	defaultRotationIntervalKey   = "settings.log.rotation.interval"
+	defaultRotationMaxAgeKey     = "settings.log.rotation.max_age"
+	defaultRotationMaxBackupsKey = "settings.log.rotation.max_backups"
+	defaultRotationCompressKey   = "settings.log.rotation.compress"
+	defaultRotationLocalTimeKey  = "settings.log.rotation.local_time"
+
+	defaultAsyncEnabledKey       = "settings.log.async.enabled"
+	defaultAsyncBufferSizeKey    = "settings.log.async.buffer_size"
+	defaultAsyncFlushIntervalKey = "settings.log.async.flush_interval"
+	defaultAsyncOverflowKey      = "settings.log.async.overflow"
+
+	defaultSamplingKey           = "settings.log.sampling"
+	defaultSamplingEnabledKey    = "settings.log.sampling.enabled"
+	defaultSamplingInitialKey    = "settings.log.sampling.initial"
+	defaultSamplingThereafterKey = "settings.log.sampling.thereafter"
+	defaultSamplingTickKey       = "settings.log.sampling.tick"
+	defaultSamplingLoggersKey    = "settings.log.sampling.loggers"
+	defaultRateLimitKey          = "settings.log.rate_limit"
+	defaultRateLimitLimitKey     = "settings.log.rate_limit.limit"
+	defaultRateLimitIntervalKey  = "settings.log.rate_limit.interval"
+	defaultRateLimitLoggersKey   = "settings.log.rate_limit.loggers"
+)
+
+// keys declares the configuration keys of the logger module
+var keys = []schema.Key{
+	{
+		Name:        defaultLogLevelKey,
+		Type:        schema.String,
+		Default:     defaultLogConfig.Level,
+		Description: schema.Text{"zh": "日志级别", "en": "log level"},
+		Enum:        []string{"debug", "info", "warn", "error", "dpanic", "panic", "fatal"},
+	},
+	{
+		Name:        defaultLogFormatKey,
+		Type:        schema.String,
+		Default:     defaultLogConfig.Format,
+		Description: schema.Text{"zh": "日志格式", "en": "log format"},
+		Enum:        []string{"console", "json"},
+	},
+	{
+		Name:        defaultLogOutputKey,
+		Type:        schema.String,
+		Default:     defaultLogConfig.Output,
+		Description: schema.Text{"zh": "输出位置,支持 stdout,stderr 或任意文件名,多个输出使用逗号分割", "en": "output, stdout, stderr or any file name, separate multiple outputs with commas"},
+	},
+	{
+		Name:        defaultLogOutputsKey,
+		Type:        schema.List,
+		Default:     []any{},
+		Description: schema.Text{"zh": "输出列表,每个输出可单独设置 output,level,format,encoder,rotation,未设置时使用上面的配置;设置后忽略 output", "en": "outputs, each with its own output, level, format, encoder and rotation, unset ones default to the settings above; output is ignored when set"},
+	},
+	{
+		Name:        defaultLogLevelsKey,
+		Type:        schema.Map,
+		Default:     map[string]any{},
+		Description: schema.Text{"zh": "命名日志(logger.Named)的级别,如 {mysql: debug, watch: warn},未设置的名称使用上级名称或 level 的级别", "en": "levels of the named loggers (logger.Named), such as {mysql: debug, watch: warn}, unset names use the level of the parent name or level"},
+	},
+	{
+		Name:        defaultRotationMaxSizeKey,
+		Type:        schema.Size,
+		Default:     "0",
+		Description: schema.Text{"zh": "日志文件达到该大小时切割,支持KB/MB/GB作为单位,0表示不按大小切割", "en": "rotate a log file when it reaches this size, supports KB/MB/GB units, 0 disables size rotation"},
+		Min:         "0",
+	},
+	{
+		Name:        defaultRotationIntervalKey,
+		Type:        schema.String,
+		Default:     "",
+		Description: schema.Text{"zh": "按时间切割,支持 daily,hourly,为空表示不按时间切割", "en": "rotate by time, daily or hourly, empty disables time rotation"},
+		Enum:        []string{"", "daily", "hourly"},
+	},
+	{
+		Name:        defaultRotationMaxAgeKey,
+		Type:        schema.Duration,
+		Default:     "0s",
+		Description: schema.Text{"zh": "切割后的文件保留时长,支持s/m/h/d作为单位,0表示不限制", "en": "how long rotated files are kept, supports s/m/h/d units, 0 keeps them forever"},
+		Min:         "0s",
+	},
+	{
+		Name:        defaultRotationMaxBackupsKey,
+		Type:        schema.Int,
+		Default:     0,
+		Description: schema.Text{"zh": "切割后的文件最多保留个数,0表示不限制", "en": "max number of rotated files kept, 0 keeps all of them"},
+		Min:         0,
+	},
+	{
+		Name:        defaultRotationCompressKey,
+		Type:        schema.Bool,
+		Default:     false,
+		Description: schema.Text{"zh": "是否使用gzip压缩切割后的文件", "en": "compress rotated files with gzip"},
+	},
+	{
+		Name:        defaultRotationLocalTimeKey,
+		Type:        schema.Bool,
+		Default:     true,
+		Description: schema.Text{"zh": "切割时间及文件名使用本地时间,否则使用UTC时间", "en": "use local time for rotation and file names, otherwise UTC"},
+	},
+	{
+		Name:        defaultAsyncEnabledKey,
+		Type:        schema.Bool,
+		Default:     false,
+		Description: schema.Text{"zh": "是否启用缓冲异步写入,退出、fatal级别及收到退出信号时会写入缓冲的日志", "en": "buffer the entries and write them asynchronously, flushed on exit, fatal entries and shutdown signals"},
+	},
+	{
+		Name:        defaultAsyncBufferSizeKey,
+		Type:        schema.Size,
+		Default:     "256KB",
+		Description: schema.Text{"zh": "缓冲区大小,支持KB/MB/GB作为单位", "en": "buffer size, supports KB/MB/GB units"},
+		Min:         "1KB",
+	},
+	{
+		Name:        defaultAsyncFlushIntervalKey,
+		Type:        schema.Duration,
+		Default:     "1s",
+		Description: schema.Text{"zh": "缓冲区写入间隔", "en": "interval of writing the buffer"},
+		Min:         "1ms",
+	},
+	{
+		Name:        defaultAsyncOverflowKey,
+		Type:        schema.String,
+		Default:     "block",
+		Description: schema.Text{"zh": "缓冲区满时的处理方式,block表示等待,drop表示丢弃error以下级别的日志并计数(logger.Dropped)", "en": "when the buffer is full, block waits and drop discards the entries below error level and counts them (logger.Dropped)"},
+		Enum:        []string{"block", "drop"},
+	},
+	{
+		Name:        defaultSamplingEnabledKey,
+		Type:        schema.Bool,
+		Default:     false,
+		Description: schema.Text{"zh": "是否启用采样,error以上级别不采样", "en": "enable sampling, levels above error are not sampled"},
+	},
+	{
+		Name:        defaultSamplingInitialKey,
+		Type:        schema.Int,
+		Default:     100,
+		Description: schema.Text{"zh": "每个tick内相同级别、名称及消息的日志先输出的条数", "en": "entries with the same level, name and message logged first in each tick"},
+		Min:         0,
+	},
+	{
+		Name:        defaultSamplingThereafterKey,
+		Type:        schema.Int,
+		Default:     100,
+		Description: schema.Text{"zh": "超过initial后每隔多少条输出一条,0表示全部丢弃", "en": "after initial, every thereafter-th entry is logged, 0 drops them all"},
+		Min:         0,
+	},
+	{
+		Name:        defaultSamplingTickKey,
+		Type:        schema.Duration,
+		Default:     "1s",
+		Description: schema.Text{"zh": "采样计数的重置周期", "en": "period after which the sampling counters are reset"},
+		Min:         "1ms",
+	},
+	{
+		Name:        defaultSamplingLoggersKey,
+		Type:        schema.Map,
+		Default:     map[string]any{},
+		Description: schema.Text{"zh": "命名日志的采样配置,如 {mysql: {initial: 10}},未设置的项使用上面的配置", "en": "sampling of the named loggers, such as {mysql: {initial: 10}}, unset options default to the settings above"},
+	},
+	{
+		Name:        defaultRateLimitLimitKey,
+		Type:        schema.Int,
+		Default:     0,
+		Description: schema.Text{"zh": "每个周期内相同级别、名称及消息的日志最多输出的条数,其余的在周期结束后汇总为一条,0表示不限制", "en": "max entries with the same level, name and message logged per interval, the others are summarized once the interval is over, 0 disables it"},
+		Min:         0,
+	},
+	{
+		Name:        defaultRateLimitIntervalKey,
+		Type:        schema.Duration,
+		Default:     "1m",
+		Description: schema.Text{"zh": "限流周期", "en": "rate limiting interval"},
+		Min:         "1ms",
+	},
+	{
+		Name:        defaultRateLimitLoggersKey,
+		Type:        schema.Map,
+		Default:     map[string]any{},
+		Description: schema.Text{"zh": "命名日志的限流配置,如 {watch: {limit: 5}},未设置的项使用上面的配置", "en": "rate limiting of the named loggers, such as {watch: {limit: 5}}, unset options default to the settings above"},
+	},
 }
 
 func (l *Logger) Register(cmd *cobra.Command) {
-	var (
-		defaultLogLevelKey  = "settings.log.level"
-		defaultLogFormatKey = "settings.log.format"
-		defaultLogOutputKey = "settings.log.output"
-	)
+	schema.Register(keys...)
+
+	// register command log-level
+	cmd.AddCommand(l.command())
+
+	// write the buffered entries once the command finished, whether it failed or not
+	cobra.OnFinalize(func() { _ = Sync() })
+
 	if !l.AddFlag {
 		// default
 		viper.SetDefault(defaultLogLevelKey, defaultLogConfig.Level)
@@ -65,143 +277,179 @@ func (l *Logger) Register(cmd *cobra.Command) {
 
 func (l *Logger) MustCheck(*cobra.Command) {}
 
-func (l *Logger) Initialize(cmd *cobra.Command) error {
-	logConfig := LogConfig{
-		Level:      viper.GetString("settings.log.level"),
-		Format:     viper.GetString("settings.log.format"),
-		Output:     viper.GetString("settings.log.output"),
-		addCaller:  l.AddCaller,
-		stacktrace: l.Stacktrace,
-	}
+func (l *Logger) Prefixes() []string {
+	return []string{"settings.log"}
+}
 
-	newLogger, err := logConfig.build()
+func (l *Logger) Initialize(cmd *cobra.Command) error {
+	p, err := l.Prepare(cmd, snapshot.Current())
 	if err != nil {
 		return err
 	}
+	p.Commit()
+	runInitialized()
 
-	if DefaultLogger != nil {
-		_ = DefaultLogger.Sync()
-		for _, file := range defaultLogConfig.preOutputFiles {
-			_ = file.Close()
-		}
+	// reopen the file outputs on signal, for logrotate without copytruncate
+	sig := l.ReopenSignal
+	if sig == nil {
+		sig = defaultReopenSignal
 	}
+	handleReopenSignal(sig)
 
-	DefaultLogger = newLogger
+	// runtime level, toggled on signal or set through the control socket
+	sig = l.LevelSignal
+	if sig == nil {
+		sig = defaultLevelSignal
+	}
+	handleLevelSignal(sig, l.LevelSignalTTL)
+	control.Handle("log-level", handleLevel)
 
+	// flush the buffered entries on shutdown
+	signals := l.ShutdownSignals
+	if signals == nil {
+		signals = defaultShutdownSignals
+	}
+	handleShutdownSignals(signals)
 	return nil
 }
 
-// LogConfig zap log config
-type LogConfig struct {
-	Level  string
-	Format string
-	Output string
+// initialized are the functions waiting for the first Initialize
+var initialized struct {
+	sync.Mutex
+	done  bool
+	funcs []func()
+}
 
-	addCaller  bool
-	stacktrace zapcore.LevelEnabler
+// AfterInitialize runs f once Initialize has applied the configured outputs and levels, or now if it has,
+// the modules initialized before the logger use it to log the entries the default level would drop
+func AfterInitialize(f func()) {
+	initialized.Lock()
+	if !initialized.done {
+		initialized.funcs = append(initialized.funcs, f)
+		initialized.Unlock()
+		return
+	}
+	initialized.Unlock()
+	f()
+}
 
-	preOutputFiles []*os.File
-	curOutputFiles []*os.File
+func runInitialized() {
+	initialized.Lock()
+	funcs := initialized.funcs
+	initialized.done, initialized.funcs = true, nil
+	initialized.Unlock()
+
+	for _, f := range funcs {
+		f()
+	}
 }
 
-func (l *LogConfig) build() (*zap.Logger, error) {
-	level, err := l.level()
+// Prepare builds the outputs from settings.log of s, committing it swaps the outputs of DefaultLogger
+func (l *Logger) Prepare(cmd *cobra.Command, s *snapshot.Snapshot) (iface.Prepared, error) {
+	logConfig := &LogConfig{
+		addCaller:  l.AddCaller,
+		stacktrace: l.Stacktrace,
+	}
+	err := s.Decode("settings.log", logConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	encoder, err := l.encoder()
+	newState, err := logConfig.build()
 	if err != nil {
 		return nil, err
 	}
+	return &prepared{config: logConfig, state: newState}, nil
+}
+
+// prepared is the outputs built by Prepare
+type prepared struct {
+	config *LogConfig
+	state  *state
+}
+
+func (p *prepared) Commit() {
+	configured, _ := parseLevel(p.config.Level)
+	setConfiguredLevel(configured)
+	setNameLevels(p.config.curLevels)
+
+	swap(p.state)
+}
+
+func (p *prepared) Discard() {
+	p.state.release()
+}
+
+// LogConfig zap log config, decoded from settings.log
+type LogConfig struct {
+	Level  string `mapstructure:"level"`
+	Format string `mapstructure:"format"`
+	Output string `mapstructure:"output"`
+	// Outputs replaces Output when set, each output has its own level, format and rotation
+	Outputs []map[string]any `mapstructure:"outputs"`
+	// Levels are the levels of the named loggers
+	Levels map[string]string `mapstructure:"levels"`
+
+	Rotation Rotation `mapstructure:"rotation"`
+	Async    Async    `mapstructure:"async"`
+
+	Sampling  Sampling  `mapstructure:"sampling"`
+	RateLimit RateLimit `mapstructure:"rate_limit"`
+
+	addCaller  bool
+	stacktrace zapcore.LevelEnabler
 
-	syncers, err := l.output()
+	curLevels map[string]zapcore.Level
+}
+
+func (l *LogConfig) build() (*state, error) {
+	_, err := parseLevel(l.Level)
 	if err != nil {
 		return nil, err
 	}
 
-	logger := zap.New(zapcore.NewCore(encoder, syncers, level))
+	levels := make(map[string]zapcore.Level, len(l.Levels))
+	for name, s := range l.Levels {
+		levels[strings.ToLower(name)], err = parseLevel(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", defaultLogLevelsKey, name, err)
+		}
+	}
+	l.curLevels = levels
 
-	if l.addCaller {
-		logger = logger.WithOptions(zap.AddCaller(), zap.AddCallerSkip(1))
+	sinks, err := l.sinks()
+	if err != nil {
+		return nil, err
 	}
 
-	if l.stacktrace != nil {
-		logger = logger.WithOptions(zap.AddStacktrace(l.stacktrace))
+	lim, err := l.limiter()
+	if err != nil {
+		return nil, err
 	}
 
-	return logger, nil
+	s := &state{stacktrace: l.stacktrace, limiter: lim}
+	for i := range sinks {
+		sinks[i].omitCaller = !l.addCaller
+		err := sinks[i].build(s)
+		if err != nil {
+			s.release()
+			if len(l.Outputs) > 0 {
+				err = fmt.Errorf("%s[%d]: %w", defaultLogOutputsKey, i, err)
+			}
+			return nil, err
+		}
+	}
+	return s, nil
 }
 
-func (l *LogConfig) level() (zap.AtomicLevel, error) {
-	level, err := zapcore.ParseLevel(l.Level)
+func parseLevel(s string) (zapcore.Level, error) {
+	level, err := zapcore.ParseLevel(s)
 	if err != nil {
-		unrecognized := "unrecognized log level: " + l.Level
+		unrecognized := "unrecognized log level: " + s
 		supported := "supported values: debug,info,warn,error,dpanic,panic,fatal"
-		return zap.NewAtomicLevelAt(zapcore.InvalidLevel), fmt.Errorf(unrecognized + ", " + supported)
-	}
-	return zap.NewAtomicLevelAt(level), nil
-}
-
-func (l *LogConfig) encoder() (zapcore.Encoder, error) {
-	// encoderConfig
-	encoderConfig := zapcore.EncoderConfig{
-		TimeKey:          "time",
-		LevelKey:         "level",
-		NameKey:          "logger",
-		CallerKey:        "caller",
-		FunctionKey:      zapcore.OmitKey,
-		MessageKey:       "message",
-		StacktraceKey:    "stacktrace",
-		LineEnding:       zapcore.DefaultLineEnding,
-		EncodeLevel:      zapcore.LowercaseLevelEncoder,
-		EncodeTime:       zapcore.TimeEncoderOfLayout(time.DateTime),
-		EncodeDuration:   zapcore.SecondsDurationEncoder,
-		EncodeCaller:     zapcore.ShortCallerEncoder,
-		EncodeName:       func(s string, encoder zapcore.PrimitiveArrayEncoder) { encoder.AppendString(s) },
-		ConsoleSeparator: "",
-	}
-
-	// encoder
-	switch l.Format {
-	case "json":
-		return zapcore.NewJSONEncoder(encoderConfig), nil
-	case "console":
-		encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
-		return zapcore.NewConsoleEncoder(encoderConfig), nil
-	default:
-		unrecognized := "unrecognized log format: " + l.Format
-		supported := "supported values: json,console"
-		return zapcore.NewConsoleEncoder(encoderConfig), fmt.Errorf(unrecognized + ", " + supported)
-	}
-}
-
-func (l *LogConfig) output() (zapcore.WriteSyncer, error) {
-	var (
-		writeSyncers   []zapcore.WriteSyncer
-		newOutputFiles []*os.File
-	)
-
-	for _, out := range strings.Split(l.Output, ",") {
-		switch out {
-		case "stdout":
-			writeSyncers = append(writeSyncers, zapcore.AddSync(os.Stdout))
-		case "stderr":
-			writeSyncers = append(writeSyncers, zapcore.AddSync(os.Stderr))
-		default:
-			file, err := os.OpenFile(out, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-			if err != nil {
-				return nil, err
-			}
-			writeSyncers = append(writeSyncers, zapcore.Lock(zapcore.AddSync(file)))
-			newOutputFiles = append(newOutputFiles, file)
-		}
+		return zapcore.InvalidLevel, fmt.Errorf(unrecognized + ", " + supported)
 	}
-
-	l.preOutputFiles = l.curOutputFiles
-	l.curOutputFiles = newOutputFiles
-
-	return zapcore.NewMultiWriteSyncer(writeSyncers...), nil
+	return level, nil
 }
 
 func Debug(msg string, fields ...zap.Field) {
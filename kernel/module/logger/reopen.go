@@ -0,0 +1,67 @@
+package logger
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Reopen reopens every file output of the current logger, used after the files are moved by
+// an external tool such as logrotate, writes are blocked while a file is reopened so no entry
+// is lost or written twice, a file failing to reopen keeps writing its previous handle
+func Reopen() error {
+	rotators.Lock()
+	files := make([]*rotator, 0, len(rotators.files))
+	for _, r := range rotators.files {
+		files = append(files, r)
+	}
+	rotators.Unlock()
+
+	var errs []error
+	for _, r := range files {
+		err := r.reopen()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reopen replaces the file handle, the previous one is closed once the new one is open
+func (r *rotator) reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.file
+	err := r.open()
+	if err != nil {
+		return err
+	}
+	return old.Close()
+}
+
+var reopenOnce sync.Once
+
+// handleReopenSignal reopens the file outputs on sig, a nil signal disables it
+func handleReopenSignal(sig os.Signal) {
+	if sig == nil {
+		return
+	}
+	reopenOnce.Do(func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, sig)
+		go func() {
+			for range ch {
+				err := Reopen()
+				if err != nil {
+					Error("reopen log files error", zap.Error(err))
+					continue
+				}
+				Info("log files reopened", zap.String("signal", sig.String()))
+			}
+		}()
+	})
+}
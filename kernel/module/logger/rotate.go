@@ -0,0 +1,330 @@
+package logger
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vvfock3r/gooey/kernel/schema"
+)
+
+// backupTimeFormat is the timestamp added to the names of rotated files
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// Rotation is the rotation configuration of the file outputs, decoded from settings.log.rotation
+type Rotation struct {
+	MaxSize    schema.ByteSize `mapstructure:"max_size"`
+	Interval   string          `mapstructure:"interval"`
+	MaxAge     time.Duration   `mapstructure:"max_age"`
+	MaxBackups int             `mapstructure:"max_backups"`
+	Compress   bool            `mapstructure:"compress"`
+	LocalTime  bool            `mapstructure:"local_time"`
+}
+
+// rotator is a file output rotated by size and time, a file is shared by all the loggers writing it,
+// so the logger built by a hot reload keeps writing through the same rotator as the one it replaces
+type rotator struct {
+	name string
+	refs int
+
+	mu       sync.Mutex
+	rotation Rotation
+	file     *os.File
+	size     int64
+	period   time.Time
+
+	cleaning sync.Mutex
+}
+
+// rotators are the open file outputs by absolute path
+var rotators = struct {
+	sync.Mutex
+	files map[string]*rotator
+}{files: make(map[string]*rotator)}
+
+// openRotator returns the rotator of a file, opening it if no logger writes it yet,
+// the rotation of a file already open is changed by setRotation once the new state is current,
+// each call must be paired with release
+func openRotator(name string, rotation Rotation) (*rotator, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return nil, err
+	}
+
+	rotators.Lock()
+	defer rotators.Unlock()
+
+	r, ok := rotators.files[abs]
+	if !ok {
+		r = &rotator{name: abs}
+		r.rotation = rotation
+		err = r.open()
+		if err != nil {
+			return nil, err
+		}
+		rotators.files[abs] = r
+	}
+	r.refs++
+	return r, nil
+}
+
+func (r *rotator) setRotation(rotation Rotation) {
+	r.mu.Lock()
+	r.rotation = rotation
+	r.mu.Unlock()
+}
+
+// release closes the file once no logger writes it anymore
+func (r *rotator) release() error {
+	rotators.Lock()
+	r.refs--
+	last := r.refs == 0
+	if last {
+		delete(rotators.files, r.name)
+	}
+	rotators.Unlock()
+
+	if !last {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// Write rotates the file when due, if the rotation fails the entry is written to the current file
+func (r *rotator) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var rotateErr error
+	if r.due(len(p)) {
+		rotateErr = r.rotate()
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+func (r *rotator) Sync() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Sync()
+}
+
+// open opens the file for appending, the rotation period starts at its modification time
+func (r *rotator) open() error {
+	err := os.MkdirAll(filepath.Dir(r.name), 0755)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(r.name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	r.file, r.size = file, info.Size()
+	r.period = r.truncate(info.ModTime())
+	if info.Size() == 0 {
+		r.period = r.truncate(r.now())
+	}
+	return nil
+}
+
+// due reports whether writing n bytes requires a rotation, an empty file is not rotated
+func (r *rotator) due(n int) bool {
+	if r.size == 0 {
+		r.period = r.truncate(r.now())
+		return false
+	}
+	if max := r.rotation.MaxSize.Bytes(); max > 0 && r.size+int64(n) > int64(max) {
+		return true
+	}
+	return r.rotation.Interval != "" && r.truncate(r.now()).After(r.period)
+}
+
+// rotate renames the current file with a timestamp and opens a new one,
+// the current file keeps being written if the rotation fails
+func (r *rotator) rotate() error {
+	backup := r.backupName()
+
+	// windows does not rename open files, the file is closed first and reopened on failure
+	if runtime.GOOS == "windows" {
+		err := r.file.Close()
+		if err != nil {
+			return err
+		}
+		err = os.Rename(r.name, backup)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Join(err, r.open())
+		}
+		err = r.open()
+		if err != nil {
+			return err
+		}
+		go r.cleanup(r.rotation)
+		return nil
+	}
+
+	err := os.Rename(r.name, backup)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	old := r.file
+	err = r.open()
+	if err != nil {
+		// the previous handle writes the renamed file until the next rotation
+		return err
+	}
+	_ = old.Close()
+
+	go r.cleanup(r.rotation)
+	return nil
+}
+
+// backupName returns an unused name for the rotated file, a counter is added if several
+// rotations happen within the same millisecond
+func (r *rotator) backupName() string {
+	ext := filepath.Ext(r.name)
+	base := fmt.Sprintf("%s-%s", strings.TrimSuffix(r.name, ext), r.now().Format(backupTimeFormat))
+	backup := base + ext
+	for i := 1; exists(backup) || exists(backup+".gz"); i++ {
+		backup = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	return backup
+}
+
+func exists(name string) bool {
+	_, err := os.Lstat(name)
+	return err == nil
+}
+
+func (r *rotator) now() time.Time {
+	if r.rotation.LocalTime {
+		return time.Now()
+	}
+	return time.Now().UTC()
+}
+
+// truncate returns the start of the rotation period of t
+func (r *rotator) truncate(t time.Time) time.Time {
+	if r.rotation.LocalTime {
+		t = t.Local()
+	} else {
+		t = t.UTC()
+	}
+	switch r.rotation.Interval {
+	case "hourly":
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case "daily":
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	default:
+		return t
+	}
+}
+
+// cleanup compresses the rotated files and removes the ones exceeding MaxBackups or MaxAge
+func (r *rotator) cleanup(rotation Rotation) {
+	r.cleaning.Lock()
+	defer r.cleaning.Unlock()
+
+	loc := time.UTC
+	if rotation.LocalTime {
+		loc = time.Local
+	}
+	ext := filepath.Ext(r.name)
+	prefix := filepath.Base(strings.TrimSuffix(r.name, ext)) + "-"
+	entries, err := os.ReadDir(filepath.Dir(r.name))
+	if err != nil {
+		return
+	}
+
+	type backup struct {
+		name string
+		time time.Time
+		n    int
+	}
+	var backups []backup
+	for _, e := range entries {
+		name := e.Name()
+		stamp := strings.TrimPrefix(name, prefix)
+		if e.IsDir() || stamp == name {
+			continue
+		}
+		stamp = strings.TrimSuffix(strings.TrimSuffix(stamp, ".gz"), ext)
+		// the counter added by backupName orders the files of the same millisecond
+		n := 0
+		if i := len(backupTimeFormat); len(stamp) > i+1 && stamp[i] == '-' {
+			n, err = strconv.Atoi(stamp[i+1:])
+			if err != nil {
+				continue
+			}
+			stamp = stamp[:i]
+		}
+		t, err := time.ParseInLocation(backupTimeFormat, stamp, loc)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{name: filepath.Join(filepath.Dir(r.name), name), time: t, n: n})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if backups[i].time.Equal(backups[j].time) {
+			return backups[i].n > backups[j].n
+		}
+		return backups[i].time.After(backups[j].time)
+	})
+
+	for i, b := range backups {
+		expired := rotation.MaxAge > 0 && time.Since(b.time) > rotation.MaxAge
+		if (rotation.MaxBackups > 0 && i >= rotation.MaxBackups) || expired {
+			_ = os.Remove(b.name)
+			continue
+		}
+		if rotation.Compress && !strings.HasSuffix(b.name, ".gz") {
+			_ = compress(b.name)
+		}
+	}
+}
+
+// compress gzips a rotated file and removes the original
+func compress(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if err1 := gz.Close(); err == nil {
+		err = err1
+	}
+	if err1 := dst.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		_ = os.Remove(name + ".gz")
+		return err
+	}
+	return os.Remove(name)
+}
@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestRotateSameMillisecond(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	r, err := openRotator(name, Rotation{MaxSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every entry exceeds the size of the file and is rotated, usually within the same millisecond
+	var want []string
+	for i := 0; i < 20; i++ {
+		line := fmt.Sprintf("entry %02d........\n", i)
+		want = append(want, line)
+		_, err = r.Write([]byte(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = r.release()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(filepath.Dir(name), "app*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(want) {
+		t.Fatalf("got %d files, want %d: %v", len(files), len(want), files)
+	}
+	var got []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(data))
+	}
+	sort.Strings(got)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("file %d holds %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRotationAppliedOnSwap(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	live, err := openRotator(name, Rotation{MaxBackups: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer live.release()
+
+	// a prepared reload opening the same file does not change the rotation until it is committed
+	s := &state{}
+	file, err := openRotator(name, Rotation{MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.files = append(s.files, stateFile{rotator: file, rotation: Rotation{MaxBackups: 2}})
+	if file != live || live.rotation.MaxBackups != 1 {
+		t.Fatalf("prepared rotation applied to the live file: %+v", live.rotation)
+	}
+	s.release()
+	if live.rotation.MaxBackups != 1 {
+		t.Fatalf("discarded rotation applied to the live file: %+v", live.rotation)
+	}
+}
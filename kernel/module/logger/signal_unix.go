@@ -0,0 +1,17 @@
+//go:build !windows
+
+package logger
+
+import (
+	"os"
+	"syscall"
+)
+
+// defaultReopenSignal reopens the file outputs, see Logger.ReopenSignal
+var defaultReopenSignal os.Signal = syscall.SIGUSR1
+
+// defaultLevelSignal toggles the debug level, see Logger.LevelSignal
+var defaultLevelSignal os.Signal = syscall.SIGUSR2
+
+// defaultShutdownSignals flush the buffered entries, see Logger.ShutdownSignals
+var defaultShutdownSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
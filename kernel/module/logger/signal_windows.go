@@ -0,0 +1,12 @@
+package logger
+
+import "os"
+
+// defaultReopenSignal and defaultLevelSignal are not supported on windows, there is no SIGUSR1 or SIGUSR2
+var (
+	defaultReopenSignal os.Signal
+	defaultLevelSignal  os.Signal
+)
+
+// defaultShutdownSignals flush the buffered entries, see Logger.ShutdownSignals
+var defaultShutdownSignals = []os.Signal{os.Interrupt}
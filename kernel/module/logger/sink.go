@@ -0,0 +1,223 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/vvfock3r/gooey/kernel/schema"
+)
+
+// stdout and stderr are shared by all the outputs writing them
+var (
+	stdout = zapcore.Lock(os.Stdout)
+	stderr = zapcore.Lock(os.Stderr)
+)
+
+// Sink is an output of the logger, decoded from an item of settings.log.outputs,
+// level, format, rotation and async default to settings.log.level, format, rotation and async
+type Sink struct {
+	Output   string   `mapstructure:"output"`
+	Level    string   `mapstructure:"level"`
+	Format   string   `mapstructure:"format"`
+	Encoder  Encoder  `mapstructure:"encoder"`
+	Rotation Rotation `mapstructure:"rotation"`
+	Async    Async    `mapstructure:"async"`
+
+	inherit    bool
+	omitCaller bool
+}
+
+// Encoder is the encoder options of a sink, a key set to "-" omits the field
+type Encoder struct {
+	TimeKey       string `mapstructure:"time_key"`
+	LevelKey      string `mapstructure:"level_key"`
+	NameKey       string `mapstructure:"name_key"`
+	CallerKey     string `mapstructure:"caller_key"`
+	MessageKey    string `mapstructure:"message_key"`
+	StacktraceKey string `mapstructure:"stacktrace_key"`
+	// TimeFormat is a Go time layout, or one of iso8601, rfc3339, rfc3339nano, millis, nanos, epoch
+	TimeFormat string `mapstructure:"time_format"`
+	// LevelEncoder is one of lowercase, capital, color, capitalColor, defaults to capital for console
+	LevelEncoder string `mapstructure:"level_encoder"`
+	// CallerEncoder is one of short, full
+	CallerEncoder string `mapstructure:"caller_encoder"`
+}
+
+// sinks returns the outputs of the logger, the comma-separated settings.log.output
+// is a shorthand for outputs sharing the level, format, rotation and async of settings.log
+func (l *LogConfig) sinks() ([]Sink, error) {
+	if len(l.Outputs) == 0 {
+		var sinks []Sink
+		for _, out := range strings.Split(l.Output, ",") {
+			sinks = append(sinks, Sink{Output: out, Level: l.Level, Format: l.Format, Rotation: l.Rotation, Async: l.Async, inherit: true})
+		}
+		return sinks, nil
+	}
+
+	sinks := make([]Sink, 0, len(l.Outputs))
+	seen := make(map[string]bool)
+	for i, item := range l.Outputs {
+		sink := Sink{Format: l.Format, Rotation: l.Rotation, Async: l.Async}
+		err := schema.Decode(item, &sink)
+		if err != nil {
+			return nil, fmt.Errorf("%s[%d]: %w", defaultLogOutputsKey, i, err)
+		}
+		if sink.Level == "" {
+			sink.Level, sink.inherit = l.Level, true
+		}
+		if sink.Output == "" {
+			return nil, fmt.Errorf("%s[%d]: output is required", defaultLogOutputsKey, i)
+		}
+		if seen[sink.Output] {
+			return nil, fmt.Errorf("%s[%d]: output %s is used twice", defaultLogOutputsKey, i, sink.Output)
+		}
+		seen[sink.Output] = true
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+func (s *Sink) encoder() (zapcore.Encoder, error) {
+	// encoderConfig
+	encoderConfig := zapcore.EncoderConfig{
+		TimeKey:          "time",
+		LevelKey:         "level",
+		NameKey:          "logger",
+		CallerKey:        "caller",
+		FunctionKey:      zapcore.OmitKey,
+		MessageKey:       "message",
+		StacktraceKey:    "stacktrace",
+		LineEnding:       zapcore.DefaultLineEnding,
+		EncodeLevel:      zapcore.LowercaseLevelEncoder,
+		EncodeTime:       zapcore.TimeEncoderOfLayout(time.DateTime),
+		EncodeDuration:   zapcore.SecondsDurationEncoder,
+		EncodeCaller:     zapcore.ShortCallerEncoder,
+		EncodeName:       func(s string, encoder zapcore.PrimitiveArrayEncoder) { encoder.AppendString(s) },
+		ConsoleSeparator: "",
+	}
+	if s.Format == "console" {
+		encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+	}
+	err := s.Encoder.apply(&encoderConfig)
+	if err != nil {
+		return nil, err
+	}
+	if s.omitCaller {
+		encoderConfig.CallerKey = zapcore.OmitKey
+	}
+
+	// encoder
+	switch s.Format {
+	case "json":
+		return zapcore.NewJSONEncoder(encoderConfig), nil
+	case "console":
+		return zapcore.NewConsoleEncoder(encoderConfig), nil
+	default:
+		unrecognized := "unrecognized log format: " + s.Format
+		supported := "supported values: json,console"
+		return zapcore.NewConsoleEncoder(encoderConfig), fmt.Errorf(unrecognized + ", " + supported)
+	}
+}
+
+// apply overrides the encoder config with the options set
+func (e *Encoder) apply(c *zapcore.EncoderConfig) error {
+	for _, key := range []struct {
+		option string
+		field  *string
+	}{
+		{e.TimeKey, &c.TimeKey},
+		{e.LevelKey, &c.LevelKey},
+		{e.NameKey, &c.NameKey},
+		{e.CallerKey, &c.CallerKey},
+		{e.MessageKey, &c.MessageKey},
+		{e.StacktraceKey, &c.StacktraceKey},
+	} {
+		switch key.option {
+		case "":
+		case "-":
+			*key.field = zapcore.OmitKey
+		default:
+			*key.field = key.option
+		}
+	}
+
+	switch strings.ToLower(e.TimeFormat) {
+	case "":
+	case "iso8601", "rfc3339", "rfc3339nano", "millis", "nanos", "epoch":
+		_ = c.EncodeTime.UnmarshalText([]byte(strings.ToLower(e.TimeFormat)))
+	default:
+		c.EncodeTime = zapcore.TimeEncoderOfLayout(e.TimeFormat)
+	}
+
+	switch e.LevelEncoder {
+	case "":
+	case "lowercase", "capital", "color", "capitalColor":
+		_ = c.EncodeLevel.UnmarshalText([]byte(e.LevelEncoder))
+	default:
+		return fmt.Errorf("unrecognized level encoder: %s, supported values: lowercase,capital,color,capitalColor", e.LevelEncoder)
+	}
+
+	switch e.CallerEncoder {
+	case "":
+	case "short", "full":
+		_ = c.EncodeCaller.UnmarshalText([]byte(e.CallerEncoder))
+	default:
+		return fmt.Errorf("unrecognized caller encoder: %s, supported values: short,full", e.CallerEncoder)
+	}
+	return nil
+}
+
+// writer returns the write syncer of the output, files are returned as a rotator to be released
+func (s *Sink) writer() (zapcore.WriteSyncer, *rotator, error) {
+	switch s.Output {
+	case "stdout":
+		return stdout, nil, nil
+	case "stderr":
+		return stderr, nil, nil
+	default:
+		file, err := openRotator(s.Output, s.Rotation)
+		if err != nil {
+			return nil, nil, err
+		}
+		return file, file, nil
+	}
+}
+
+// build adds the core of the sink to st, its file and buffer are released with st
+func (s *Sink) build(st *state) error {
+	own, err := parseLevel(s.Level)
+	if err != nil {
+		return err
+	}
+
+	encoder, err := s.encoder()
+	if err != nil {
+		return err
+	}
+
+	writer, file, err := s.writer()
+	if err != nil {
+		return err
+	}
+	if file != nil {
+		st.files = append(st.files, stateFile{rotator: file, rotation: s.Rotation})
+	}
+	var critical zapcore.Core
+	if s.Async.Enabled {
+		async := newAsyncWriter(writer, s.Output, s.Async)
+		st.asyncs = append(st.asyncs, async)
+		writer = async
+		if async.drop {
+			critical = zapcore.NewCore(encoder.Clone(), async.blocking(), zapcore.DebugLevel)
+		}
+	}
+
+	// entries are filtered by levelCore
+	core := zapcore.NewCore(encoder, writer, zapcore.DebugLevel)
+	st.cores = append(st.cores, &levelCore{Core: core, critical: critical, own: own, inherit: s.inherit})
+	return nil
+}
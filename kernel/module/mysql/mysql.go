@@ -2,9 +2,11 @@ package mysql
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
@@ -14,53 +16,206 @@ import (
 	"go.uber.org/zap"
 	"golang.org/x/crypto/ssh/terminal"
 
+	"github.com/vvfock3r/gooey/kernel/iface"
 	"github.com/vvfock3r/gooey/kernel/module/logger"
+	"github.com/vvfock3r/gooey/kernel/schema"
+	"github.com/vvfock3r/gooey/kernel/snapshot"
 )
 
-var DB *sqlx.DB
+// db is the connection pool in service, swapped when the configuration changes
+var db atomic.Pointer[sqlx.DB]
+
+// DB returns the connection pool in service, it is nil if the module is not initialized,
+// call it for each use instead of keeping the pool, a replaced pool is closed after DrainDelay
+func DB() *sqlx.DB {
+	return db.Load()
+}
 
 var (
-	defaultHostKey   = "settings.mysql.host"
+	// defaultPrefix holds the configuration of the default database, it was settings.mysql before schema version 2
+	defaultPrefix = "settings.databases.default"
+	legacyPrefix  = "settings.mysql"
+
+	defaultHostKey   = defaultPrefix + ".host"
 	defaultHostValue = "127.0.0.1"
 
-	defaultPortKey   = "settings.mysql.port"
+	defaultPortKey   = defaultPrefix + ".port"
 	defaultPortValue = "3306"
 
-	defaultUserKey   = "settings.mysql.user"
+	defaultUserKey   = defaultPrefix + ".user"
 	defaultUserValue = "root"
 
-	defaultPasswordKey   = "settings.mysql.password"
+	defaultPasswordKey   = defaultPrefix + ".password"
 	defaultPasswordValue = ""
 
-	defaultDatabaseKey   = "settings.mysql.database"
+	defaultDatabaseKey   = defaultPrefix + ".database"
 	defaultDatabaseValue = ""
 
-	defaultCharsetKey   = "settings.mysql.charset"
+	defaultCharsetKey   = defaultPrefix + ".charset"
 	defaultCharsetValue = "utf8mb4"
 
-	defaultCollationKey   = "settings.mysql.collation"
+	defaultCollationKey   = defaultPrefix + ".collation"
 	defaultCollationValue = "utf8mb4_general_ci"
 
-	defaultConntimeoutKey   = "settings.mysql.connect_timeout"
+	defaultConntimeoutKey   = defaultPrefix + ".connect_timeout"
 	defaultConntimeoutValue = "5s"
 
-	defaultReadtimeoutKey   = "settings.mysql.read_timeout"
+	defaultReadtimeoutKey   = defaultPrefix + ".read_timeout"
 	defaultReadtimeoutValue = "30s"
 
-	defaultWritetimeoutKey   = "settings.mysql.write_timeout"
+	defaultWritetimeoutKey   = defaultPrefix + ".write_timeout"
 	defaultWritetimeoutValue = "30s"
 
-	defaultMaxAllowedPacketKey   = "settings.mysql.max_allowed_packet"
+	defaultMaxAllowedPacketKey   = defaultPrefix + ".max_allowed_packet"
 	defaultMaxAllowedPacketValue = "16MB"
 )
 
+// keys declares the configuration keys of the mysql module
+var keys = []schema.Key{
+	{
+		Name:        defaultHostKey,
+		Type:        schema.String,
+		Default:     defaultHostValue,
+		Description: schema.Text{"zh": "数据库地址", "en": "database host"},
+	},
+	{
+		Name:        defaultPortKey,
+		Type:        schema.Int,
+		Default:     defaultPortValue,
+		Description: schema.Text{"zh": "数据库端口", "en": "database port"},
+		Min:         1,
+		Max:         65535,
+	},
+	{
+		Name:        defaultUserKey,
+		Type:        schema.String,
+		Default:     defaultUserValue,
+		Description: schema.Text{"zh": "用户名", "en": "user name"},
+	},
+	{
+		Name:        defaultPasswordKey,
+		Type:        schema.String,
+		Default:     defaultPasswordValue,
+		Description: schema.Text{"zh": "密码,为空时交互式输入", "en": "password, prompted interactively when empty"},
+		Secret:      true,
+	},
+	{
+		Name:        defaultDatabaseKey,
+		Type:        schema.String,
+		Default:     defaultDatabaseValue,
+		Description: schema.Text{"zh": "数据库名", "en": "database name"},
+	},
+	{
+		Name:        defaultCharsetKey,
+		Type:        schema.String,
+		Default:     defaultCharsetValue,
+		Description: schema.Text{"zh": "字符集", "en": "charset"},
+	},
+	{
+		Name:        defaultCollationKey,
+		Type:        schema.String,
+		Default:     defaultCollationValue,
+		Description: schema.Text{"zh": "排序规则", "en": "collation"},
+	},
+	{
+		Name:        defaultConntimeoutKey,
+		Type:        schema.Duration,
+		Default:     defaultConntimeoutValue,
+		Description: schema.Text{"zh": "连接超时时间,需要带单位,支持s/m/h作为单位", "en": "connect timeout, a unit is required, supports s/m/h units"},
+	},
+	{
+		Name:        defaultReadtimeoutKey,
+		Type:        schema.Duration,
+		Default:     defaultReadtimeoutValue,
+		Description: schema.Text{"zh": "读超时时间,需要带单位,支持s/m/h作为单位", "en": "read timeout, a unit is required, supports s/m/h units"},
+	},
+	{
+		Name:        defaultWritetimeoutKey,
+		Type:        schema.Duration,
+		Default:     defaultWritetimeoutValue,
+		Description: schema.Text{"zh": "写超时时间,需要带单位,支持s/m/h作为单位", "en": "write timeout, a unit is required, supports s/m/h units"},
+	},
+	{
+		Name:        defaultMaxAllowedPacketKey,
+		Type:        schema.Size,
+		Default:     defaultMaxAllowedPacketValue,
+		Description: schema.Text{"zh": "最大数据包大小,支持KB/MB/GB作为单位", "en": "max allowed packet, supports KB/MB/GB units"},
+	},
+}
+
+// Options is the mysql module configuration, decoded from settings.databases.default
+type Options struct {
+	Host             string          `mapstructure:"host"`
+	Port             int             `mapstructure:"port"`
+	User             string          `mapstructure:"user"`
+	Password         string          `mapstructure:"password"`
+	Database         string          `mapstructure:"database"`
+	Charset          string          `mapstructure:"charset"`
+	Collation        string          `mapstructure:"collation"`
+	ConnectTimeout   time.Duration   `mapstructure:"connect_timeout"`
+	ReadTimeout      time.Duration   `mapstructure:"read_timeout"`
+	WriteTimeout     time.Duration   `mapstructure:"write_timeout"`
+	MaxAllowedPacket schema.ByteSize `mapstructure:"max_allowed_packet"`
+}
+
+func (o *Options) Validate() error {
+	if o.MaxAllowedPacket <= 0 {
+		return fmt.Errorf("the max_allowed_packet parameter must be greater than 0")
+	}
+	return nil
+}
+
+// config builds the go-sql-driver/mysql configuration
+func (o *Options) config() *mysql.Config {
+	return &mysql.Config{
+		User:                 o.User,
+		Passwd:               o.Password,
+		Net:                  "tcp",
+		Addr:                 net.JoinHostPort(o.Host, strconv.Itoa(o.Port)),
+		DBName:               o.Database,
+		Params:               map[string]string{"charset": o.Charset},
+		Collation:            o.Collation,
+		Loc:                  time.Local,
+		ParseTime:            true,
+		Timeout:              o.ConnectTimeout,
+		ReadTimeout:          o.ReadTimeout,
+		WriteTimeout:         o.WriteTimeout,
+		CheckConnLiveness:    true,
+		AllowNativePasswords: true,
+		MaxAllowedPacket:     int(o.MaxAllowedPacket.Bytes()),
+	}
+}
+
 // MySQL implement the Module interface
 type MySQL struct {
 	AddFlag         bool
 	AllowedCommands []string
+	// DrainDelay is how long a replaced pool keeps serving the callers still holding it, defaults to 30s,
+	// closing it then waits for the in-flight queries
+	DrainDelay time.Duration
+
+	// password is the password entered interactively, used while the configuration has none
+	password string
 }
 
 func (m *MySQL) Register(cmd *cobra.Command) {
+	schema.Register(keys...)
+
+	// settings.mysql moved under settings.databases, the configuration files are upgraded on load
+	schema.RegisterMigration(schema.Migration{
+		From:        1,
+		Description: fmt.Sprintf("move %s to %s", legacyPrefix, defaultPrefix),
+		Apply: func(t schema.Tree) error {
+			t.Move(legacyPrefix, defaultPrefix)
+			return nil
+		},
+	})
+
+	// the parameter names of the driver DSN are accepted as deprecated aliases
+	schema.RegisterAlias(defaultPrefix+".passwd", defaultPasswordKey)
+	schema.RegisterAlias(defaultPrefix+".dbname", defaultDatabaseKey)
+	schema.RegisterAlias(defaultPrefix+".timeout", defaultConntimeoutKey)
+
 	if !m.AddFlag {
 		// default
 		viper.SetDefault(defaultHostKey, defaultHostValue)
@@ -139,81 +294,113 @@ func (m *MySQL) Register(cmd *cobra.Command) {
 
 func (m *MySQL) MustCheck(*cobra.Command) {}
 
+func (m *MySQL) Prefixes() []string {
+	return []string{defaultPrefix}
+}
+
 func (m *MySQL) Initialize(cmd *cobra.Command) error {
 	// allow connection to database
 	if !m.allow(cmd) {
 		return nil
 	}
 
+	// replace the Logger inside go-sql-driver/mysql
+	err := mysql.SetLogger(&mysqlLogger{})
+	if err != nil {
+		panic(err)
+	}
+
 	// enable interactive password
-	if strings.TrimSpace(viper.GetString(defaultPasswordKey)) == "" {
+	var opts Options
+	err = snapshot.Current().Decode(defaultPrefix, &opts)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(opts.Password) == "" {
 		fmt.Printf("Password: ")
 		password, err := terminal.ReadPassword(int(os.Stdin.Fd()))
 		if err != nil {
 			panic(err)
 		}
 		fmt.Println()
-		viper.Set(defaultPasswordKey, password)
+		m.password = string(password)
 	}
 
-	// long parameter
-	addr := viper.GetString(defaultHostKey) + ":" + viper.GetString(defaultPortKey)
-	params := map[string]string{"charset": viper.GetString(defaultCharsetKey)}
-
-	// max_allowed_packet
-	packet := strings.ToLower(viper.GetString(defaultMaxAllowedPacketKey))
-	if !strings.HasSuffix(packet, "mb") {
-		logger.Error("the max_allowed_packet parameter must specify the mb unit")
-		os.Exit(1)
-	}
-	maxAllowedPacketMB, err := strconv.Atoi(strings.TrimSuffix(packet, "mb"))
+	// connect to the database
+	p, err := m.Prepare(cmd, snapshot.Current())
 	if err != nil {
-		logger.Error("the max_allowed_packet parameter type conversion failed")
-		os.Exit(1)
+		log().Fatal("connect database error", zap.Error(err))
 	}
+	p.Commit()
+	log().Info("connect database success")
+	return nil
+}
 
-	// build configuration
-	mysqlConfig := mysql.Config{
-		User:                 viper.GetString(defaultUserKey),
-		Passwd:               viper.GetString(defaultPasswordKey),
-		Net:                  "tcp",
-		Addr:                 addr,
-		DBName:               viper.GetString(defaultDatabaseKey),
-		Params:               params,
-		Collation:            viper.GetString(defaultCollationKey),
-		Loc:                  time.Local,
-		ParseTime:            true,
-		Timeout:              viper.GetDuration(defaultConntimeoutKey),
-		ReadTimeout:          viper.GetDuration(defaultReadtimeoutKey),
-		WriteTimeout:         viper.GetDuration(defaultWritetimeoutKey),
-		CheckConnLiveness:    true,
-		AllowNativePasswords: true,
-		MaxAllowedPacket:     maxAllowedPacketMB << 20, // N MiB
+// Prepare connects a new pool with settings.databases.default of s, committing it puts the pool in service,
+// the current pool is kept if the new one cannot connect
+func (m *MySQL) Prepare(cmd *cobra.Command, s *snapshot.Snapshot) (iface.Prepared, error) {
+	if !m.allow(cmd) {
+		return &prepared{}, nil
 	}
 
-	// replace the Logger inside go-sql-driver/mysql
-	err = mysql.SetLogger(&mysqlLogger{logger: logger.DefaultLogger})
+	// decode options
+	var opts Options
+	err := s.Decode(defaultPrefix, &opts)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	// connect to the database
-	db, err := sqlx.Connect("mysql", mysqlConfig.FormatDSN())
+	// the password entered interactively at startup
+	if strings.TrimSpace(opts.Password) == "" {
+		opts.Password = m.password
+	}
+
+	// connect to the database, sqlx.Connect pings it
+	newDB, err := sqlx.Connect("mysql", opts.config().FormatDSN())
 	if err != nil {
-		logger.Error("connect database error", zap.Error(err))
-		os.Exit(1)
+		return nil, err
 	}
-	logger.Info("connect database success")
 
 	// set up connection pool
-	db.SetMaxOpenConns(100)
-	db.SetMaxIdleConns(10)
-	db.SetConnMaxIdleTime(time.Second * 300)
+	newDB.SetMaxOpenConns(100)
+	newDB.SetMaxIdleConns(10)
+	newDB.SetConnMaxIdleTime(time.Second * 300)
+
+	drainDelay := m.DrainDelay
+	if drainDelay <= 0 {
+		drainDelay = 30 * time.Second
+	}
+	return &prepared{db: newDB, drainDelay: drainDelay}, nil
+}
 
-	// global DB
-	DB = db
+// prepared is a pool connected by Prepare
+type prepared struct {
+	db         *sqlx.DB
+	drainDelay time.Duration
+}
 
-	return nil
+func (p *prepared) Commit() {
+	if p.db == nil {
+		return
+	}
+	old := db.Swap(p.db)
+	if old == nil {
+		return
+	}
+
+	// callers that loaded the old pool just before the swap may still start queries on it
+	time.AfterFunc(p.drainDelay, func() {
+		err := old.Close()
+		if err != nil {
+			log().Warn("close database error", zap.Error(err))
+		}
+	})
+}
+
+func (p *prepared) Discard() {
+	if p.db != nil {
+		_ = p.db.Close()
+	}
 }
 
 func (m *MySQL) allow(cmd *cobra.Command) bool {
@@ -225,10 +412,14 @@ func (m *MySQL) allow(cmd *cobra.Command) bool {
 	return false
 }
 
-type mysqlLogger struct {
-	logger *zap.Logger
-}
+// mysqlLogger is the logger of go-sql-driver/mysql, named mysql.driver
+type mysqlLogger struct{}
 
 func (l *mysqlLogger) Print(v ...any) {
-	l.logger.Error(fmt.Sprint(v...))
+	logger.Named("mysql.driver").Error(fmt.Sprint(v...))
+}
+
+// log returns the logger of the mysql module, named mysql in settings.log.levels
+func log() *zap.Logger {
+	return logger.Named("mysql")
 }
@@ -0,0 +1,88 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vvfock3r/gooey/kernel/module/control"
+)
+
+// handleSignal reloads the configuration on SIGHUP
+func (w *Watch) handleSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			w.reload(w.cmd, "sighup", "")
+		}
+	}()
+}
+
+func (w *Watch) command() *cobra.Command {
+	var (
+		pid    int
+		socket string
+	)
+	cmd := &cobra.Command{
+		Use:   "reload",
+		Short: "Reload the configuration of a running instance",
+		Long: "Reload the configuration of a running instance through its control socket and print the per-module results\n" +
+			"With --pid a SIGHUP is sent instead, the results are only logged by the instance",
+		Args: cobra.NoArgs,
+		// the running instance is reloaded, the modules of this process are not initialized
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if pid > 0 {
+				process, err := os.FindProcess(pid)
+				if err != nil {
+					return err
+				}
+				err = process.Signal(syscall.SIGHUP)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("SIGHUP sent to %d\n", pid)
+				return nil
+			}
+
+			result, callErr := control.Call(socket, "reload")
+			var r struct {
+				Trigger string
+				Version uint64
+				Changes []struct{ Key, Op string }
+				Results []struct{ Module, Err string }
+			}
+			if len(result) > 0 {
+				err := json.Unmarshal(result, &r)
+				if err != nil {
+					return err
+				}
+			}
+			for _, c := range r.Changes {
+				fmt.Printf("%s: %s\n", c.Op, c.Key)
+			}
+			for _, m := range r.Results {
+				if m.Err != "" {
+					fmt.Printf("%s: %s\n", m.Module, m.Err)
+				} else {
+					fmt.Printf("%s: ok\n", m.Module)
+				}
+			}
+			if callErr != nil {
+				return callErr
+			}
+			if len(r.Changes) == 0 {
+				fmt.Println("config unchanged")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&pid, "pid", 0, "send SIGHUP to the process instead of using the control socket")
+	cmd.Flags().StringVar(&socket, "socket", "", "control socket of the instance, defaults to --control-socket")
+	return cmd
+}
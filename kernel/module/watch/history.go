@@ -0,0 +1,107 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vvfock3r/gooey/kernel/snapshot"
+)
+
+// defaultHistorySize is the number of reloads kept when Watch.HistorySize is not set
+const defaultHistorySize = 32
+
+// Record describes a config reload
+type Record struct {
+	Time time.Time
+	// Trigger is the file or URL whose change caused the reload
+	Trigger string
+	// Version is the version of the snapshot stored by the reload, 0 if the reload failed
+	Version uint64
+	// Changes are the keys changed by the reload, secrets are redacted
+	Changes []snapshot.Change
+	// Results are the modules reinitialized by the reload
+	Results []Result
+	Err     error
+}
+
+// Result is the outcome of reinitializing a module
+type Result struct {
+	Module string
+	Err    error
+}
+
+func (r Record) MarshalJSON() ([]byte, error) {
+	type record Record
+	return json.Marshal(struct {
+		record
+		Err string `json:",omitempty"`
+	}{record: record(r), Err: errString(r.Err)})
+}
+
+func (r Result) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Module string
+		Err    string `json:",omitempty"`
+	}{Module: r.Module, Err: errString(r.Err)})
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// Handler is called after each reload, including the failed ones
+type Handler func(Record)
+
+var history struct {
+	sync.Mutex
+	size     int
+	records  []Record
+	handlers []Handler
+}
+
+// OnReload registers a handler called after each reload
+func OnReload(h Handler) {
+	history.Lock()
+	defer history.Unlock()
+	history.handlers = append(history.handlers, h)
+}
+
+// History returns the latest reloads, oldest first
+func History() []Record {
+	history.Lock()
+	defer history.Unlock()
+	return append([]Record(nil), history.records...)
+}
+
+// record appends r to the bounded history and passes it to the handlers
+func record(r Record) {
+	history.Lock()
+	size := history.size
+	if size <= 0 {
+		size = defaultHistorySize
+	}
+	history.records = append(history.records, r)
+	if len(history.records) > size {
+		history.records = append([]Record(nil), history.records[len(history.records)-size:]...)
+	}
+	handlers := append([]Handler(nil), history.handlers...)
+	history.Unlock()
+
+	for _, h := range handlers {
+		func() {
+			defer func() {
+				if v := recover(); v != nil {
+					log().Error("config reload handler panic", zap.String("detail", fmt.Sprint(v)))
+				}
+			}()
+			h(r)
+		}()
+	}
+}
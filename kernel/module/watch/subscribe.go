@@ -0,0 +1,143 @@
+package watch
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/vvfock3r/gooey/kernel/snapshot"
+)
+
+// subscription receives the reloads changing keys under prefix, the callbacks of a subscription
+// run one at a time on its own goroutine, in reload order
+type subscription struct {
+	prefix  string
+	deliver func(old, new *snapshot.Snapshot)
+
+	mu    sync.Mutex
+	queue [][2]*snapshot.Snapshot
+	wake  chan struct{}
+	done  chan struct{}
+}
+
+var subscriptions struct {
+	sync.Mutex
+	list []*subscription
+}
+
+// Subscribe calls fn after each reload changing a key under prefix, with the subtree of prefix before
+// and after the reload decoded into T, an empty prefix matches every key, it returns the unsubscribe function,
+// fn is not called if the decoded values are equal
+func Subscribe[T any](prefix string, fn func(old, new T)) (unsubscribe func()) {
+	prefix = strings.ToLower(prefix)
+	s := &subscription{
+		prefix: prefix,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	s.deliver = func(before, after *snapshot.Snapshot) {
+		var old, new T
+		err := before.Decode(prefix, &old)
+		if err == nil {
+			err = after.Decode(prefix, &new)
+		}
+		if err != nil {
+			log().Error("config subscriber decode error", zap.String("prefix", prefix), zap.Error(err))
+			return
+		}
+		// the changed keys may not be part of T
+		if reflect.DeepEqual(old, new) {
+			return
+		}
+		fn(old, new)
+	}
+
+	subscriptions.Lock()
+	subscriptions.list = append(subscriptions.list, s)
+	subscriptions.Unlock()
+	go s.run()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			subscriptions.Lock()
+			for i, item := range subscriptions.list {
+				if item == s {
+					subscriptions.list = append(subscriptions.list[:i:i], subscriptions.list[i+1:]...)
+					break
+				}
+			}
+			subscriptions.Unlock()
+			close(s.done)
+		})
+	}
+}
+
+// notify queues a committed reload for the subscriptions whose keys changed
+func notify(old, new *snapshot.Snapshot, changes []snapshot.Change) {
+	subscriptions.Lock()
+	defer subscriptions.Unlock()
+
+	for _, s := range subscriptions.list {
+		for _, c := range changes {
+			if !under(c.Key, s.prefix) {
+				continue
+			}
+			s.mu.Lock()
+			s.queue = append(s.queue, [2]*snapshot.Snapshot{old, new})
+			s.mu.Unlock()
+			select {
+			case s.wake <- struct{}{}:
+			default:
+			}
+			break
+		}
+	}
+}
+
+func (s *subscription) run() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		}
+		for {
+			s.mu.Lock()
+			if len(s.queue) == 0 {
+				s.mu.Unlock()
+				break
+			}
+			item := s.queue[0]
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			s.call(item[0], item[1])
+		}
+	}
+}
+
+// call runs the callback, a panic is logged and the subscription keeps running
+func (s *subscription) call(old, new *snapshot.Snapshot) {
+	defer func() {
+		if v := recover(); v != nil {
+			log().Error("config subscriber panic",
+				zap.String("prefix", s.prefix),
+				zap.String("detail", fmt.Sprint(v)))
+		}
+	}()
+	s.deliver(old, new)
+}
+
+// under reports whether key is prefix or below it, an empty prefix matches every key
+func under(key string, prefix string) bool {
+	return prefix == "" || key == prefix || strings.HasPrefix(key, prefix+".")
+}
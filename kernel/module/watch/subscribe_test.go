@@ -0,0 +1,140 @@
+package watch
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vvfock3r/gooey/kernel/snapshot"
+)
+
+type appConfig struct {
+	N int `mapstructure:"n"`
+}
+
+type delivery struct {
+	old, new appConfig
+}
+
+// publish notifies the subscriptions of a reload from old to new settings of settings.app
+func publish(old, new map[string]any) {
+	before := snapshot.New(map[string]any{"settings": map[string]any{"app": old}})
+	after := snapshot.New(map[string]any{"settings": map[string]any{"app": new}})
+	notify(before, after, snapshot.Diff(before, after))
+}
+
+// receive waits for the next delivery
+func receive(t *testing.T, ch <-chan delivery) delivery {
+	t.Helper()
+	select {
+	case d := <-ch:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery")
+		return delivery{}
+	}
+}
+
+func TestSubscribeOrder(t *testing.T) {
+	const reloads = 100
+	var (
+		ch      = make(chan delivery, reloads)
+		running atomic.Int32
+		overlap atomic.Bool
+	)
+	unsubscribe := Subscribe("settings.app", func(old, new appConfig) {
+		if running.Add(1) > 1 {
+			overlap.Store(true)
+		}
+		time.Sleep(100 * time.Microsecond)
+		running.Add(-1)
+		ch <- delivery{old, new}
+	})
+	defer unsubscribe()
+
+	for i := 1; i <= reloads; i++ {
+		publish(map[string]any{"n": i - 1}, map[string]any{"n": i})
+	}
+	for i := 1; i <= reloads; i++ {
+		d := receive(t, ch)
+		if d.old.N != i-1 || d.new.N != i {
+			t.Fatalf("delivery %d is %+v, want the reloads in order", i, d)
+		}
+	}
+	if overlap.Load() {
+		t.Error("callbacks of one subscriber ran concurrently")
+	}
+}
+
+func TestSubscribePanic(t *testing.T) {
+	ch := make(chan delivery, 2)
+	unsubscribe := Subscribe("settings.app", func(old, new appConfig) {
+		if new.N == 1 {
+			panic("subscriber failed")
+		}
+		ch <- delivery{old, new}
+	})
+	defer unsubscribe()
+
+	// the subscription keeps running after a panic
+	publish(map[string]any{"n": 0}, map[string]any{"n": 1})
+	publish(map[string]any{"n": 1}, map[string]any{"n": 2})
+	if d := receive(t, ch); d.new.N != 2 {
+		t.Fatalf("got %+v, want the reload after the panic", d)
+	}
+}
+
+func TestSubscribeUnchanged(t *testing.T) {
+	ch := make(chan delivery, 2)
+	unsubscribe := Subscribe("settings.app", func(old, new appConfig) {
+		ch <- delivery{old, new}
+	})
+	defer unsubscribe()
+
+	// other is under the prefix but not part of appConfig
+	publish(map[string]any{"n": 1, "other": "a"}, map[string]any{"n": 1, "other": "b"})
+	publish(map[string]any{"n": 1}, map[string]any{"n": 2})
+	if d := receive(t, ch); d.old.N != 1 || d.new.N != 2 {
+		t.Fatalf("got %+v, want the unchanged reload skipped", d)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	ch := make(chan delivery, 2)
+	unsubscribe := Subscribe("settings.app", func(old, new appConfig) {
+		ch <- delivery{old, new}
+	})
+
+	publish(map[string]any{"n": 0}, map[string]any{"n": 1})
+	receive(t, ch)
+
+	unsubscribe()
+	unsubscribe()
+	subscriptions.Lock()
+	n := len(subscriptions.list)
+	subscriptions.Unlock()
+	if n != 0 {
+		t.Fatalf("%d subscriptions left after unsubscribe", n)
+	}
+	publish(map[string]any{"n": 1}, map[string]any{"n": 2})
+	select {
+	case d := <-ch:
+		t.Fatalf("got %+v after unsubscribe", d)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSubscribePrefix(t *testing.T) {
+	ch := make(chan delivery, 1)
+	unsubscribe := Subscribe("settings.other", func(old, new appConfig) {
+		ch <- delivery{old, new}
+	})
+	defer unsubscribe()
+
+	publish(map[string]any{"n": 0}, map[string]any{"n": 1})
+	select {
+	case d := <-ch:
+		t.Fatalf("got %+v for a change under another prefix", d)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -4,59 +4,220 @@ import (
 	"fmt"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 	"go.uber.org/zap"
 
 	"github.com/vvfock3r/gooey/kernel/iface"
+	"github.com/vvfock3r/gooey/kernel/module/config"
+	"github.com/vvfock3r/gooey/kernel/module/control"
 	"github.com/vvfock3r/gooey/kernel/module/logger"
+	"github.com/vvfock3r/gooey/kernel/snapshot"
 )
 
-// Watch implement the Module interface
+// Watch implement the Module interface, the modules of List implementing iface.Reloadable are
+// reloaded in list order when their keys changed, List is usually the module list itself
 type Watch struct {
+	// List is in dependency order like the module list, a module comes after the modules it depends on,
+	// the affected modules are prepared in this order and committed in this order once all prepared,
+	// so a module is committed after its dependencies but must not rely on their prepared state in Prepare
 	List []iface.Module
+	// HistorySize is the number of reloads kept by History, defaults to 32
+	HistorySize int
+	// Quiet is the period without file events before a change is applied, defaults to 200ms
+	Quiet time.Duration
+	// Poll forces polling the config files instead of fsnotify
+	Poll bool
+	// PollInterval is the polling interval, used when fsnotify is unavailable, defaults to 2s
+	PollInterval time.Duration
+
+	reloading sync.Mutex
+	watcher   *watcher
+	cmd       *cobra.Command
+}
+
+// active is the initialized Watch used by Reload
+var active struct {
+	sync.Mutex
+	watch *Watch
 }
 
-func (w *Watch) Register(*cobra.Command) {}
+func (w *Watch) Register(cmd *cobra.Command) {
+	// register command reload
+	cmd.AddCommand(w.command())
+}
 
 func (w *Watch) MustCheck(*cobra.Command) {}
 
 func (w *Watch) Initialize(cmd *cobra.Command) error {
+	history.Lock()
+	history.size = w.HistorySize
+	history.Unlock()
+
+	// reload api, SIGHUP and the control command
+	w.cmd = cmd
+	active.Lock()
+	active.watch = w
+	active.Unlock()
+	w.handleSignal()
+	control.Handle("reload", func([]string) (any, error) {
+		r := w.reload(cmd, "command", "")
+		return r, r.Err
+	})
+
+	// remote config is polled by the config module
+	if config.WatchRemote(func(name string) {
+		w.reload(cmd, "poll", name)
+	}) {
+		return nil
+	}
+
 	// skip if config file is not used
-	if viper.ConfigFileUsed() == "" {
+	files := config.Files()
+	if len(files) == 0 {
 		return nil
 	}
 
-	// config watch
-	viper.WatchConfig()
-	viper.OnConfigChange(func(e fsnotify.Event) {
-		// print log
-		fileName := e.Name
-		fileAbsName, err := filepath.Abs(fileName)
-		if err == nil {
-			fileName = fileAbsName
-		}
+	// config watch, the main file, included and merged files
+	quiet, poll := w.Quiet, w.PollInterval
+	if quiet <= 0 {
+		quiet = 200 * time.Millisecond
+	}
+	if poll <= 0 {
+		poll = 2 * time.Second
+	}
+	w.watcher = newWatcher(quiet, poll, w.Poll, func(operation string, name string) {
+		w.reload(cmd, operation, name)
+	})
+	w.watcher.update(files)
+	return nil
+}
+
+// Reload reloads the configuration of the running instance and returns the per-module results
+func Reload() (Record, error) {
+	active.Lock()
+	w := active.watch
+	active.Unlock()
+
+	if w == nil {
+		return Record{}, fmt.Errorf("the watch module is not initialized")
+	}
+	r := w.reload(w.cmd, "api", "")
+	return r, r.Err
+}
+
+// reload applies the changed configuration to the modules in List,
+// name is the changed file, empty if the reload is requested by a signal or a command
+func (w *Watch) reload(cmd *cobra.Command, operation string, name string) Record {
+	w.reloading.Lock()
+	defer w.reloading.Unlock()
+
+	// print log
+	fileName := name
+	if !strings.Contains(fileName, "://") {
 		fileName = filepath.ToSlash(fileName)
-		operation := strings.ToLower(e.Op.String())
-		logger.Warn("config update trigger",
-			zap.String("operation", operation),
-			zap.String("filename", fileName))
-
-		// initialize
-		for _, m := range w.List {
-			err = m.Initialize(cmd)
-			if err != nil {
-				logger.Warn("config reload ignored",
-					zap.String("object", fmt.Sprintf("%T", m)),
-					zap.String("detail", err.Error()))
-			} else {
-				logger.Warn("config reload success",
-					zap.String("object", fmt.Sprintf("%T", m)),
-					zap.String("detail", "success"))
+	}
+	log().Warn("config update trigger",
+		zap.String("operation", operation),
+		zap.String("filename", fileName))
+
+	r := Record{Time: time.Now(), Trigger: fileName}
+	if r.Trigger == "" {
+		r.Trigger = operation
+	}
+	err := w.apply(cmd, &r)
+	if err != nil {
+		log().Error("config reload rolled back",
+			zap.String("filename", fileName),
+			zap.String("detail", err.Error()))
+		r.Err = err
+	}
+	record(r)
+	return r
+}
+
+// apply reloads the configuration in two phases, the new snapshot is validated and every affected
+// module implementing iface.Preparer prepares its new state, everything is committed only if all
+// succeeded, otherwise the previous snapshot stays active
+func (w *Watch) apply(cmd *cobra.Command, r *Record) error {
+	// phase 1: parse and validate the new configuration, then prepare the affected modules
+	old := snapshot.Current()
+	s, rollback, err := config.Reload()
+	if err != nil {
+		return err
+	}
+	r.Changes = snapshot.Diff(old, s)
+	if len(r.Changes) == 0 {
+		log().Warn("config unchanged", zap.String("filename", r.Trigger))
+		return nil
+	}
+
+	var (
+		modules  []iface.Reloadable
+		prepared []iface.Prepared
+	)
+	for _, m := range w.List {
+		reloadable, ok := m.(iface.Reloadable)
+		if !ok || !affected(reloadable, r.Changes) {
+			continue
+		}
+		p, err := reloadable.Prepare(cmd, s)
+		if err != nil {
+			r.Results = append(r.Results, Result{Module: fmt.Sprintf("%T", m), Err: err})
+			for _, p := range prepared {
+				p.Discard()
 			}
+			rollback()
+			return fmt.Errorf("%T: %w", m, err)
 		}
-	})
+		modules = append(modules, reloadable)
+		prepared = append(prepared, p)
+	}
+
+	// phase 2: commit
+	snapshot.Store(s)
+	r.Version = s.Version()
+	for _, c := range r.Changes {
+		log().Warn("config changed",
+			zap.String("key", c.Key),
+			zap.String("op", string(c.Op)),
+			zap.Any("old", c.Old),
+			zap.Any("new", c.New))
+	}
+
+	// the set of included files may have changed
+	if w.watcher != nil {
+		w.watcher.update(config.Files())
+	}
+
+	for i, m := range modules {
+		prepared[i].Commit()
+		r.Results = append(r.Results, Result{Module: fmt.Sprintf("%T", m)})
+		log().Warn("config reload success",
+			zap.String("object", fmt.Sprintf("%T", m)),
+			zap.String("detail", "success"))
+	}
+
+	// user code subscribed to the changed keys
+	notify(old, s, r.Changes)
 	return nil
 }
+
+// affected reports whether m must be reloaded, that is a key under one of its prefixes changed
+func affected(m iface.Scoped, changes []snapshot.Change) bool {
+	for _, c := range changes {
+		for _, prefix := range m.Prefixes() {
+			if under(c.Key, strings.ToLower(prefix)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// log returns the logger of the watch module, named watch in settings.log.levels
+func log() *zap.Logger {
+	return logger.Named("watch")
+}
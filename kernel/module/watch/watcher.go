@@ -0,0 +1,180 @@
+package watch
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// watcher reports changes of the config files, it watches their directories and the directories
+// of their symlink targets, so editors replacing files and Kubernetes ConfigMap symlink swaps are
+// noticed, events are debounced and files whose content did not change are ignored
+type watcher struct {
+	quiet    time.Duration
+	poll     time.Duration
+	onChange func(operation string, name string)
+
+	mu      sync.Mutex
+	fs      *fsnotify.Watcher
+	polling bool
+	files   []string
+	names   map[string]bool
+	dirs    map[string]bool
+	hashes  map[string][sha256.Size]byte
+	timer   *time.Timer
+}
+
+// newWatcher starts watching, it falls back to polling every poll if fsnotify is unavailable or forcePoll is set
+func newWatcher(quiet, poll time.Duration, forcePoll bool, onChange func(operation string, name string)) *watcher {
+	w := &watcher{quiet: quiet, poll: poll, onChange: onChange}
+	if !forcePoll {
+		fs, err := fsnotify.NewWatcher()
+		if err != nil {
+			log().Warn("config watch falls back to polling", zap.Error(err))
+		} else {
+			w.fs = fs
+			go w.run()
+		}
+	}
+	if w.fs == nil {
+		w.polling = true
+		go w.pollLoop()
+	}
+	return w
+}
+
+// update replaces the watched files and records their current content,
+// the directories of the files no longer watched are removed from fsnotify
+func (w *watcher) update(files []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.files = files
+	w.names = make(map[string]bool)
+	w.hashes = make(map[string][sha256.Size]byte)
+	dirs := make(map[string]bool)
+	for _, name := range files {
+		if sum, ok := hash(name); ok {
+			w.hashes[name] = sum
+		}
+		w.names[filepath.Base(name)] = true
+		if w.fs == nil {
+			continue
+		}
+
+		for _, dir := range []string{filepath.Dir(name), filepath.Dir(target(name))} {
+			if dirs[dir] {
+				continue
+			}
+			dirs[dir] = true
+			err := w.fs.Add(dir)
+			if err != nil && !w.polling {
+				log().Warn("config watch falls back to polling", zap.String("filename", name), zap.Error(err))
+				w.polling = true
+				go w.pollLoop()
+			}
+		}
+	}
+
+	for dir := range w.dirs {
+		if !dirs[dir] {
+			// the watch of a deleted directory is already gone
+			_ = w.fs.Remove(dir)
+		}
+	}
+	w.dirs = dirs
+}
+
+// target returns the file a symlink points to, name itself if it is not a symlink or cannot be resolved
+func target(name string) string {
+	if target, err := filepath.EvalSymlinks(name); err == nil {
+		return target
+	}
+	return name
+}
+
+// run debounces the fsnotify events of the watched directories
+func (w *watcher) run() {
+	for {
+		select {
+		case e, ok := <-w.fs.Events:
+			if !ok {
+				return
+			}
+			if e.Op == fsnotify.Chmod || !w.relevant(e.Name) {
+				continue
+			}
+			w.mu.Lock()
+			if w.timer != nil {
+				w.timer.Stop()
+			}
+			w.timer = time.AfterFunc(w.quiet, func() { w.check("write") })
+			w.mu.Unlock()
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return
+			}
+			log().Warn("config watch error", zap.Error(err))
+		}
+	}
+}
+
+// pollLoop checks the content of the watched files periodically
+func (w *watcher) pollLoop() {
+	for range time.Tick(w.poll) {
+		w.check("poll")
+	}
+}
+
+// relevant reports whether an event may change a watched file, other files in the same directories
+// are ignored, ConfigMaps swap the hidden ..data symlink
+func (w *watcher) relevant(name string) bool {
+	base := filepath.Base(name)
+	if strings.HasPrefix(base, "..") {
+		return true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.names[base]
+}
+
+// check compares the content of the watched files with the recorded hashes and reports the first changed file
+func (w *watcher) check(operation string) {
+	w.mu.Lock()
+	var changed string
+	for _, name := range w.files {
+		sum, ok := hash(name)
+		if !ok {
+			// the file is being replaced, the next event checks it again
+			continue
+		}
+		if previous, ok := w.hashes[name]; ok && previous == sum {
+			continue
+		}
+		w.hashes[name] = sum
+		if changed == "" {
+			changed = name
+		}
+	}
+	w.mu.Unlock()
+
+	if changed != "" {
+		w.onChange(operation, changed)
+	}
+}
+
+// hash returns the sha256 of the content of a file, following symlinks
+func hash(name string) ([sha256.Size]byte, bool) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return [sha256.Size]byte{}, false
+	}
+	return sha256.Sum256(data), true
+}
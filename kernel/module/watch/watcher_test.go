@@ -0,0 +1,44 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestWatcherUpdateRemovesDirectories(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	for _, dir := range []string{a, b} {
+		err := os.WriteFile(filepath.Join(dir, "default.yaml"), nil, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := newWatcher(time.Hour, time.Hour, false, func(string, string) {})
+	if w.fs == nil {
+		t.Skip("fsnotify is unavailable")
+	}
+	defer w.fs.Close()
+
+	watched := func() []string {
+		list := w.fs.WatchList()
+		sort.Strings(list)
+		return list
+	}
+	w.update([]string{filepath.Join(a, "default.yaml"), filepath.Join(b, "default.yaml")})
+	want := []string{a, b}
+	sort.Strings(want)
+	if got := watched(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("watching %v, want %v", got, want)
+	}
+
+	// the file of a is no longer included
+	w.update([]string{filepath.Join(b, "default.yaml")})
+	if got := watched(); !reflect.DeepEqual(got, []string{b}) {
+		t.Fatalf("watching %v after the update, want %v", got, []string{b})
+	}
+}
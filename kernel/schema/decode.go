@@ -0,0 +1,64 @@
+package schema
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// ByteSize is a byte size decoded from values such as 512, 64KB or 16MB
+type ByteSize int64
+
+func (s *ByteSize) UnmarshalText(text []byte) error {
+	n, err := ParseSize(string(text))
+	if err != nil {
+		return err
+	}
+	*s = ByteSize(n)
+	return nil
+}
+
+func (s ByteSize) Bytes() int64 {
+	return int64(s)
+}
+
+// Validator is implemented by option structs that check themselves after decoding
+type Validator interface {
+	Validate() error
+}
+
+// Decode decodes a configuration subtree into out, which must be a pointer to a struct,
+// fields are matched by the mapstructure tag and out is validated if it implements Validator
+func Decode(input any, out any) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			durationHook,
+			mapstructure.TextUnmarshallerHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+		WeaklyTypedInput: true,
+		Result:           out,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = decoder.Decode(input)
+	if err != nil {
+		return err
+	}
+
+	if v, ok := out.(Validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+// durationHook decodes durations with case-insensitive units
+func durationHook(from reflect.Type, to reflect.Type, data any) (any, error) {
+	if from.Kind() != reflect.String || to != reflect.TypeOf(time.Duration(0)) {
+		return data, nil
+	}
+	return ParseDuration(data.(string))
+}
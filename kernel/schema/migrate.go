@@ -0,0 +1,211 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// VersionKey holds the schema version of a config file, a file without it is at version 1
+const VersionKey = "schema_version"
+
+// Tree is the view of a configuration file that migrations operate on, keys are dotted paths
+type Tree interface {
+	Get(key string) (any, bool)
+	Set(key string, value any)
+	Delete(key string)
+	// Move renames a key or a subtree, it reports whether from exists
+	Move(from, to string) bool
+}
+
+// Migration upgrades a configuration file from version From to From+1
+type Migration struct {
+	From        int
+	Description string
+	Apply       func(Tree) error
+}
+
+// Deprecation is a deprecated key that is an alias of another key
+type Deprecation struct {
+	Old string
+	New string
+}
+
+// Report describes the changes made by Migrate
+type Report struct {
+	From       int
+	To         int
+	Applied    []string
+	Deprecated []Deprecation
+}
+
+// Changed reports whether the tree was modified
+func (r Report) Changed() bool {
+	return r.From != r.To || len(r.Deprecated) > 0
+}
+
+var migrations = struct {
+	sync.RWMutex
+	list    map[int]Migration
+	aliases []Deprecation
+}{list: make(map[int]Migration)}
+
+// RegisterMigration registers the migration from version m.From to m.From+1
+func RegisterMigration(m Migration) {
+	migrations.Lock()
+	defer migrations.Unlock()
+
+	if m.From < 1 {
+		panic(fmt.Sprintf("schema: invalid migration version %d", m.From))
+	}
+	if _, ok := migrations.list[m.From]; ok {
+		panic(fmt.Sprintf("schema: migration from version %d registered twice", m.From))
+	}
+	migrations.list[m.From] = m
+}
+
+// RegisterAlias declares old as a deprecated alias of new, it is renamed when loading and migrating
+func RegisterAlias(old, new string) {
+	migrations.Lock()
+	defer migrations.Unlock()
+
+	migrations.aliases = append(migrations.aliases, Deprecation{Old: strings.ToLower(old), New: strings.ToLower(new)})
+}
+
+// LatestVersion returns the version reached by applying all registered migrations
+func LatestVersion() int {
+	migrations.RLock()
+	defer migrations.RUnlock()
+
+	version := 1
+	for {
+		if _, ok := migrations.list[version]; !ok {
+			return version
+		}
+		version++
+	}
+}
+
+// Migrate upgrades t to the latest version and renames the deprecated aliases
+func Migrate(t Tree) (Report, error) {
+	latest := LatestVersion()
+	report := Report{From: 1, To: 1}
+
+	if value, ok := t.Get(VersionKey); ok {
+		n, err := number(Int, value)
+		if err != nil || n < 1 {
+			return report, fmt.Errorf("%s: invalid version %v", VersionKey, value)
+		}
+		report.From, report.To = int(n), int(n)
+	}
+	if report.From > latest {
+		return report, fmt.Errorf("%s: config version %d is newer than the supported version %d", VersionKey, report.From, latest)
+	}
+
+	migrations.RLock()
+	defer migrations.RUnlock()
+
+	for report.To < latest {
+		m := migrations.list[report.To]
+		err := m.Apply(t)
+		if err != nil {
+			return report, fmt.Errorf("migrate config from version %d: %w", m.From, err)
+		}
+		report.Applied = append(report.Applied, m.Description)
+		report.To++
+	}
+	if report.From != report.To {
+		t.Set(VersionKey, report.To)
+	}
+
+	for _, alias := range migrations.aliases {
+		if _, ok := t.Get(alias.Old); !ok {
+			continue
+		}
+		if _, ok := t.Get(alias.New); ok {
+			// the new key wins
+			t.Delete(alias.Old)
+		} else {
+			t.Move(alias.Old, alias.New)
+		}
+		report.Deprecated = append(report.Deprecated, alias)
+	}
+	return report, nil
+}
+
+// MapTree implements Tree on nested settings with lowercase keys, it records the moved keys
+type MapTree struct {
+	Settings map[string]any
+	Moves    []Deprecation
+}
+
+func (t *MapTree) Get(key string) (any, bool) {
+	parent, name := t.parent(key, false)
+	if parent == nil {
+		return nil, false
+	}
+	value, ok := parent[name]
+	return value, ok
+}
+
+func (t *MapTree) Set(key string, value any) {
+	parent, name := t.parent(key, true)
+	parent[name] = value
+}
+
+func (t *MapTree) Delete(key string) {
+	parent, name := t.parent(key, false)
+	if parent == nil {
+		return
+	}
+	delete(parent, name)
+	t.prune(key)
+}
+
+func (t *MapTree) Move(from, to string) bool {
+	value, ok := t.Get(from)
+	if !ok {
+		return false
+	}
+	t.Delete(from)
+	t.Set(to, value)
+	t.Moves = append(t.Moves, Deprecation{Old: strings.ToLower(from), New: strings.ToLower(to)})
+	return true
+}
+
+// parent returns the mapping holding key and the last part of key
+func (t *MapTree) parent(key string, create bool) (map[string]any, string) {
+	parts := strings.Split(strings.ToLower(key), ".")
+	if t.Settings == nil {
+		t.Settings = make(map[string]any)
+	}
+	m := t.Settings
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := m[part].(map[string]any)
+		if !ok {
+			if !create {
+				return nil, ""
+			}
+			child = make(map[string]any)
+			m[part] = child
+		}
+		m = child
+	}
+	return m, parts[len(parts)-1]
+}
+
+// prune removes the empty mappings left on the path of a deleted key
+func (t *MapTree) prune(key string) {
+	parts := strings.Split(strings.ToLower(key), ".")
+	for i := len(parts) - 1; i > 0; i-- {
+		parent, name := t.parent(strings.Join(parts[:i], "."), false)
+		if parent == nil {
+			return
+		}
+		if m, ok := parent[name].(map[string]any); ok && len(m) == 0 {
+			delete(parent, name)
+			continue
+		}
+		return
+	}
+}
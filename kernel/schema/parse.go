@@ -0,0 +1,129 @@
+package schema
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var sizeUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"kb", 1 << 10},
+	{"mb", 1 << 20},
+	{"gb", 1 << 30},
+	{"tb", 1 << 40},
+	{"k", 1 << 10},
+	{"m", 1 << 20},
+	{"g", 1 << 30},
+	{"t", 1 << 40},
+	{"b", 1},
+}
+
+// ParseSize parses a byte size such as 512, 64KB or 16MB, units are case-insensitive and 1024-based
+func ParseSize(s string) (int64, error) {
+	text := strings.ToLower(strings.TrimSpace(s))
+	factor := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(text, unit.suffix) {
+			text = strings.TrimSpace(strings.TrimSuffix(text, unit.suffix))
+			factor = unit.factor
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil || n < 0 || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return int64(n * float64(factor)), nil
+}
+
+// ParseDuration parses a duration such as 30s or 5M, units are case-insensitive
+func ParseDuration(s string) (time.Duration, error) {
+	text := strings.TrimSpace(s)
+	d, err := time.ParseDuration(text)
+	if err == nil {
+		return d, nil
+	}
+	d, err = time.ParseDuration(strings.ToLower(text))
+	if err == nil {
+		return d, nil
+	}
+
+	// days, such as 7d or 1d12h
+	if days, rest, ok := strings.Cut(strings.ToLower(text), "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err == nil && n >= 0 {
+			d = time.Duration(n) * 24 * time.Hour
+			if rest == "" {
+				return d, nil
+			}
+			r, err := time.ParseDuration(rest)
+			if err == nil {
+				return d + r, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("invalid duration: %q", s)
+}
+
+// number converts a value of the given type to a comparable number,
+// durations are measured in nanoseconds and sizes in bytes, a duration without unit must be 0
+func number(t Type, v any) (float64, error) {
+	switch t {
+	case Int, Float:
+		switch n := v.(type) {
+		case int:
+			return float64(n), nil
+		case int64:
+			return float64(n), nil
+		case uint64:
+			return float64(n), nil
+		case float64:
+			if t == Int && n != math.Trunc(n) {
+				return 0, fmt.Errorf("invalid %s: %v", t, n)
+			}
+			return n, nil
+		case string:
+			f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid %s: %q", t, n)
+			}
+			if t == Int && f != math.Trunc(f) {
+				return 0, fmt.Errorf("invalid %s: %q", t, n)
+			}
+			return f, nil
+		}
+	case Duration:
+		switch d := v.(type) {
+		case time.Duration:
+			return float64(d), nil
+		case int, int64, uint64:
+			// a bare number is ambiguous, only 0 is accepted without a unit
+			if fmt.Sprint(d) != "0" {
+				return 0, fmt.Errorf("invalid %s: %v, a unit is required, such as %vs", t, d, d)
+			}
+			return 0, nil
+		case string:
+			n, err := ParseDuration(d)
+			return float64(n), err
+		}
+	case Size:
+		switch n := v.(type) {
+		case int:
+			return float64(n), nil
+		case int64:
+			return float64(n), nil
+		case uint64:
+			return float64(n), nil
+		case string:
+			size, err := ParseSize(n)
+			return float64(size), err
+		}
+	}
+	return 0, fmt.Errorf("expected %s, got %T", t, v)
+}
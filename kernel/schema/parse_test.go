@@ -0,0 +1,34 @@
+package schema
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNumberDuration(t *testing.T) {
+	tests := []struct {
+		value any
+		want  time.Duration
+		err   bool
+	}{
+		{value: 0, want: 0},
+		{value: uint64(0), want: 0},
+		{value: "0", want: 0},
+		{value: "5s", want: 5 * time.Second},
+		{value: "7d", want: 7 * 24 * time.Hour},
+		{value: "1d12h", want: 36 * time.Hour},
+		{value: 5, err: true},
+		{value: 1.5, err: true},
+		{value: "5x", err: true},
+	}
+	for _, tt := range tests {
+		n, err := number(Duration, tt.value)
+		if (err != nil) != tt.err {
+			t.Errorf("number(%v): unexpected error: %v", tt.value, err)
+			continue
+		}
+		if err == nil && time.Duration(n) != tt.want {
+			t.Errorf("number(%v) = %v, want %v", tt.value, time.Duration(n), tt.want)
+		}
+	}
+}
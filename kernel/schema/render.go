@@ -0,0 +1,116 @@
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var labels = map[string]Text{
+	"type":   {"zh": "类型", "en": "type"},
+	"enum":   {"zh": "可选值", "en": "allowed values"},
+	"secret": {"zh": "敏感信息,请妥善保管此文件", "en": "secret, keep this file private"},
+}
+
+type node struct {
+	name     string
+	key      *Key
+	children []*node
+}
+
+func (n *node) child(name string) *node {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	c := &node{name: name}
+	n.children = append(n.children, c)
+	return c
+}
+
+// Render renders all registered keys as a commented YAML document
+func Render(lang string) ([]byte, error) {
+	root := &node{}
+	for _, key := range Keys() {
+		key := key
+		n := root
+		for _, part := range strings.Split(key.Name, ".") {
+			n = n.child(part)
+		}
+		n.key = &key
+	}
+
+	var buf bytes.Buffer
+	for i, c := range root.children {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		if err := c.render(&buf, lang, 0); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (n *node) render(buf *bytes.Buffer, lang string, depth int) error {
+	indent := strings.Repeat("  ", depth)
+
+	if n.key == nil {
+		fmt.Fprintf(buf, "%s%s:\n", indent, n.name)
+		for i, c := range n.children {
+			if i > 0 && c.key == nil {
+				buf.WriteString("\n")
+			}
+			if err := c.render(buf, lang, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	key := n.key
+	if desc := key.Description.Get(lang); desc != "" {
+		for _, line := range strings.Split(desc, "\n") {
+			fmt.Fprintf(buf, "%s# %s\n", indent, line)
+		}
+	}
+	fmt.Fprintf(buf, "%s# %s: %s\n", indent, labels["type"].Get(lang), key.Type)
+	if len(key.Enum) > 0 {
+		fmt.Fprintf(buf, "%s# %s: %s\n", indent, labels["enum"].Get(lang), strings.Join(key.Enum, ", "))
+	}
+	if key.Secret {
+		fmt.Fprintf(buf, "%s# %s\n", indent, labels["secret"].Get(lang))
+	}
+
+	value, err := yaml.Marshal(key.Default)
+	if err != nil {
+		return fmt.Errorf("schema: render %s: %w", key.Name, err)
+	}
+	value = bytes.TrimRight(value, "\n")
+	if s, ok := key.Default.(string); ok && s != "" && key.Type != String {
+		// numbers, durations and sizes are declared as strings for flags
+		value = []byte(s)
+	}
+	if key.Default == nil || key.Type == StringSlice || key.Type == List || key.Type == Map {
+		// block values are rendered on their own lines
+		fmt.Fprintf(buf, "%s%s:", indent, n.name)
+		if key.Default == nil {
+			buf.WriteString("\n")
+			return nil
+		}
+		if len(value) > 0 && (value[0] == '[' || value[0] == '{') {
+			fmt.Fprintf(buf, " %s\n", value)
+			return nil
+		}
+		buf.WriteString("\n")
+		for _, line := range strings.Split(string(value), "\n") {
+			fmt.Fprintf(buf, "%s  %s\n", indent, line)
+		}
+		return nil
+	}
+	fmt.Fprintf(buf, "%s%s: %s\n", indent, n.name, value)
+	return nil
+}
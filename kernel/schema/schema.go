@@ -0,0 +1,169 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Type is the value type of a configuration key
+type Type int
+
+const (
+	String Type = iota
+	Int
+	Bool
+	Float
+	Duration
+	Size
+	StringSlice
+	// List is a list of mappings, such as the log outputs, the items are checked by the module
+	List
+	// Map is a mapping of arbitrary names, such as the per-component log levels
+	Map
+)
+
+func (t Type) String() string {
+	switch t {
+	case String:
+		return "string"
+	case Int:
+		return "int"
+	case Bool:
+		return "bool"
+	case Float:
+		return "float"
+	case Duration:
+		return "duration"
+	case Size:
+		return "size"
+	case StringSlice:
+		return "[]string"
+	case List:
+		return "[]map"
+	case Map:
+		return "map"
+	default:
+		return "unknown"
+	}
+}
+
+// Text is a localized text, the key is the language, such as zh or en
+type Text map[string]string
+
+// DefaultLang is used when the requested language is missing
+const DefaultLang = "zh"
+
+// Get returns the text of the given language, falling back to DefaultLang and then any language
+func (t Text) Get(lang string) string {
+	if s, ok := t[lang]; ok {
+		return s
+	}
+	if s, ok := t[DefaultLang]; ok {
+		return s
+	}
+	langs := make([]string, 0, len(t))
+	for l := range t {
+		langs = append(langs, l)
+	}
+	sort.Strings(langs)
+	if len(langs) > 0 {
+		return t[langs[0]]
+	}
+	return ""
+}
+
+// Key describes a configuration key declared by a module
+type Key struct {
+	Name        string
+	Type        Type
+	Default     any
+	Description Text
+	Enum        []string
+	Min         any
+	Max         any
+	Required    bool
+	Secret      bool
+}
+
+var registry = struct {
+	sync.RWMutex
+	keys  []*Key
+	index map[string]*Key
+}{index: make(map[string]*Key)}
+
+func init() {
+	Register(Key{
+		Name:        VersionKey,
+		Type:        Int,
+		Description: Text{"zh": "配置文件版本,用于自动迁移,请勿手动修改", "en": "config file version used by migrations, do not edit"},
+		Min:         1,
+	})
+}
+
+// Register declares configuration keys, registering the same key twice is a programming error
+func Register(keys ...Key) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	for i := range keys {
+		key := keys[i]
+		key.Name = strings.ToLower(key.Name)
+		if _, ok := registry.index[key.Name]; ok {
+			panic(fmt.Sprintf("schema: key %s registered twice", key.Name))
+		}
+		registry.keys = append(registry.keys, &key)
+		registry.index[key.Name] = &key
+	}
+}
+
+// Keys returns all registered keys in registration order
+func Keys() []Key {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	keys := make([]Key, 0, len(registry.keys))
+	for _, key := range registry.keys {
+		k := *key
+		if k.Name == VersionKey {
+			k.Default = LatestVersion()
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Lookup returns the key with the given name
+func Lookup(name string) (Key, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	key, ok := registry.index[strings.ToLower(name)]
+	if !ok {
+		return Key{}, false
+	}
+	return *key, true
+}
+
+// Redacted replaces the values of secret keys in output
+const Redacted = "******"
+
+// IsSecret reports whether name is a registered key holding a secret
+func IsSecret(name string) bool {
+	key, ok := Lookup(name)
+	return ok && key.Secret
+}
+
+// HasSecrets reports whether any registered key holds a secret
+func HasSecrets() bool {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	for _, key := range registry.keys {
+		if key.Secret {
+			return true
+		}
+	}
+	return false
+}
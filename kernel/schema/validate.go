@@ -0,0 +1,372 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// error kinds, use errors.Is to check the kind of an *Error
+var (
+	ErrUnknownKey = errors.New("unknown key")
+	ErrType       = errors.New("invalid type")
+	ErrEnum       = errors.New("value not allowed")
+	ErrRange      = errors.New("value out of range")
+	ErrRequired   = errors.New("required key missing")
+)
+
+// Position is a location inside a configuration file, Line and Column are 1-based,
+// File is only set when the key comes from another file than the document
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// Error is a validation error of a single key
+type Error struct {
+	Kind error
+	Key  string
+	File string
+	Pos  Position
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File)
+		if e.Pos.Line > 0 {
+			fmt.Fprintf(&b, ":%d:%d", e.Pos.Line, e.Pos.Column)
+		}
+		b.WriteString(": ")
+	}
+	fmt.Fprintf(&b, "%s: %s", e.Key, e.Kind)
+	if e.Msg != "" {
+		b.WriteString(", " + e.Msg)
+	}
+	return b.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// Errors collects all validation errors
+type Errors []*Error
+
+func (e Errors) Error() string {
+	lines := make([]string, 0, len(e))
+	for _, err := range e {
+		lines = append(lines, err.Error())
+	}
+	return "config validation failed:\n  " + strings.Join(lines, "\n  ")
+}
+
+// Document is the set of keys present in a configuration file
+type Document struct {
+	File string
+	Keys map[string]Position
+}
+
+// NewDocument builds a document from flattened keys, used by formats without position information
+func NewDocument(file string, keys []string) *Document {
+	doc := &Document{File: file, Keys: make(map[string]Position, len(keys))}
+	for _, key := range keys {
+		doc.Keys[strings.ToLower(key)] = Position{}
+	}
+	return doc
+}
+
+// ParseYAML builds a document from YAML source, recording the position of every leaf key
+func ParseYAML(file string, src []byte) (*Document, error) {
+	doc := &Document{File: file, Keys: make(map[string]Position)}
+
+	var root yaml.Node
+	err := yaml.Unmarshal(src, &root)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if len(root.Content) > 0 {
+		doc.walk("", root.Content[0])
+	}
+	return doc, nil
+}
+
+// Merge adds the keys of other that are not present in d, they are reported with the file of other
+func (d *Document) Merge(other *Document) {
+	for key, pos := range other.Keys {
+		if _, ok := d.Keys[key]; ok {
+			continue
+		}
+		if pos.File == "" {
+			pos.File = other.File
+		}
+		d.Keys[key] = pos
+	}
+}
+
+// Rename moves the keys under from to the same place under to, used after keys are migrated
+func (d *Document) Rename(from, to string) {
+	moved := make(map[string]Position)
+	for key, pos := range d.Keys {
+		if key == from || strings.HasPrefix(key, from+".") {
+			moved[to+strings.TrimPrefix(key, from)] = pos
+			delete(d.Keys, key)
+		}
+	}
+	for key, pos := range moved {
+		d.Keys[key] = pos
+	}
+}
+
+func (d *Document) walk(prefix string, n *yaml.Node) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		name := strings.ToLower(k.Value)
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		if v.Kind == yaml.MappingNode && len(v.Content) > 0 && !isLeaf(name) {
+			d.walk(name, v)
+			continue
+		}
+		d.Keys[name] = Position{Line: k.Line, Column: k.Column}
+	}
+}
+
+// isLeaf reports whether name is a registered key, so its value is not walked into
+func isLeaf(name string) bool {
+	_, ok := Lookup(name)
+	return ok
+}
+
+// Validate checks the document keys and the effective values against the registered keys,
+// get returns the effective value of a key, nil means not set
+func Validate(doc *Document, get func(key string) any) error {
+	var errs Errors
+	if doc == nil {
+		doc = &Document{}
+	}
+
+	newError := func(kind error, key string, msg string) *Error {
+		pos := doc.Keys[key]
+		file := doc.File
+		if pos.File != "" {
+			file = pos.File
+		}
+		return &Error{Kind: kind, Key: key, File: file, Pos: pos, Msg: msg}
+	}
+
+	// unknown keys
+	names := make([]string, 0, len(doc.Keys))
+	for name := range doc.Keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := Lookup(name); ok {
+			continue
+		}
+		if isPrefix(name) {
+			errs = append(errs, newError(ErrType, name, "expected a mapping"))
+			continue
+		}
+		msg := ""
+		if suggestion := suggest(name); suggestion != "" {
+			msg = fmt.Sprintf("did you mean %s?", suggestion)
+		}
+		errs = append(errs, newError(ErrUnknownKey, name, msg))
+	}
+
+	// values
+	for _, key := range Keys() {
+		value := get(key.Name)
+		if isEmpty(value) {
+			if key.Required {
+				errs = append(errs, newError(ErrRequired, key.Name, ""))
+			}
+			continue
+		}
+		msg, kind := key.check(value)
+		if kind != nil {
+			errs = append(errs, newError(kind, key.Name, msg))
+		}
+	}
+
+	// sort by file and position, errors without position go last
+	sort.SliceStable(errs, func(i, j int) bool {
+		pi, pj := errs[i].Pos, errs[j].Pos
+		if (pi.Line == 0) != (pj.Line == 0) {
+			return pi.Line != 0
+		}
+		if pi.File != pj.File {
+			return pi.File < pj.File
+		}
+		return pi.Line < pj.Line || pi.Line == pj.Line && pi.Column < pj.Column
+	})
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// check validates a single value, returning a detail message and the error kind
+func (k Key) check(value any) (string, error) {
+	switch k.Type {
+	case String:
+		switch value.(type) {
+		case map[string]any, []any:
+			return fmt.Sprintf("expected %s, got %T", k.Type, value), ErrType
+		}
+	case Bool:
+		switch v := value.(type) {
+		case bool:
+		case string:
+			_, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Sprintf("expected %s, got %q", k.Type, v), ErrType
+			}
+		default:
+			return fmt.Sprintf("expected %s, got %T", k.Type, value), ErrType
+		}
+	case StringSlice:
+		switch v := value.(type) {
+		case string:
+		case []string:
+		case []any:
+			for _, item := range v {
+				if _, ok := item.(string); !ok {
+					return fmt.Sprintf("expected %s, got item %v", k.Type, item), ErrType
+				}
+			}
+		default:
+			return fmt.Sprintf("expected %s, got %T", k.Type, value), ErrType
+		}
+	case List:
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Sprintf("expected %s, got %T", k.Type, value), ErrType
+		}
+		for i, item := range items {
+			switch item.(type) {
+			case map[string]any, map[any]any:
+			default:
+				return fmt.Sprintf("expected %s, got item %d: %v", k.Type, i, item), ErrType
+			}
+		}
+	case Map:
+		switch value.(type) {
+		case map[string]any, map[any]any:
+		default:
+			return fmt.Sprintf("expected %s, got %T", k.Type, value), ErrType
+		}
+	case Int, Float, Duration, Size:
+		n, err := number(k.Type, value)
+		if err != nil {
+			return err.Error(), ErrType
+		}
+		if k.Min != nil {
+			min, err := number(k.Type, k.Min)
+			if err == nil && n < min {
+				return fmt.Sprintf("%v is less than %v", value, k.Min), ErrRange
+			}
+		}
+		if k.Max != nil {
+			max, err := number(k.Type, k.Max)
+			if err == nil && n > max {
+				return fmt.Sprintf("%v is greater than %v", value, k.Max), ErrRange
+			}
+		}
+	}
+
+	if len(k.Enum) > 0 {
+		s := fmt.Sprint(value)
+		for _, e := range k.Enum {
+			if s == e {
+				return "", nil
+			}
+		}
+		return fmt.Sprintf("%q not in [%s]", s, strings.Join(k.Enum, ",")), ErrEnum
+	}
+	return "", nil
+}
+
+func isEmpty(value any) bool {
+	if value == nil {
+		return true
+	}
+	s, ok := value.(string)
+	return ok && strings.TrimSpace(s) == ""
+}
+
+// isPrefix reports whether name is the parent of any registered key
+func isPrefix(name string) bool {
+	for _, key := range Keys() {
+		if strings.HasPrefix(key.Name, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// suggest returns the registered key closest to name, or an empty string if nothing is close enough
+func suggest(name string) string {
+	best, bestDistance := "", -1
+	for _, key := range Keys() {
+		d := distance(name, key.Name)
+		if bestDistance < 0 || d < bestDistance {
+			best, bestDistance = key.Name, d
+		}
+	}
+	limit := len(name) / 4
+	if limit < 2 {
+		limit = 2
+	}
+	if bestDistance < 0 || bestDistance > limit {
+		return ""
+	}
+	return best
+}
+
+// distance returns the Levenshtein distance between a and b
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,94 @@
+package snapshot
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/vvfock3r/gooey/kernel/schema"
+)
+
+// Op is the kind of change of a key
+type Op string
+
+const (
+	Added   Op = "added"
+	Removed Op = "removed"
+	Changed Op = "changed"
+)
+
+// Change is a key whose value differs between two snapshots, values of secret keys are redacted
+type Change struct {
+	Key string
+	Op  Op
+	Old any
+	New any
+}
+
+func (c Change) String() string {
+	switch c.Op {
+	case Added:
+		return fmt.Sprintf("+ %s = %v", c.Key, c.New)
+	case Removed:
+		return fmt.Sprintf("- %s = %v", c.Key, c.Old)
+	default:
+		return fmt.Sprintf("~ %s: %v -> %v", c.Key, c.Old, c.New)
+	}
+}
+
+// Diff returns the leaf keys added, removed or changed from old to new, sorted by key,
+// a nil snapshot has no keys
+func Diff(old, new *Snapshot) []Change {
+	before, after := make(map[string]any), make(map[string]any)
+	if old != nil {
+		flatten(before, "", old.settings)
+	}
+	if new != nil {
+		flatten(after, "", new.settings)
+	}
+
+	var changes []Change
+	for key, value := range before {
+		other, ok := after[key]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Key: key, Op: Removed, Old: value})
+		case !reflect.DeepEqual(value, other):
+			changes = append(changes, Change{Key: key, Op: Changed, Old: value, New: other})
+		}
+	}
+	for key, value := range after {
+		if _, ok := before[key]; !ok {
+			changes = append(changes, Change{Key: key, Op: Added, New: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+
+	for i, c := range changes {
+		if schema.IsSecret(c.Key) {
+			if c.Old != nil {
+				changes[i].Old = schema.Redacted
+			}
+			if c.New != nil {
+				changes[i].New = schema.Redacted
+			}
+		}
+	}
+	return changes
+}
+
+// flatten collects the leaf values of nested settings by dotted key, empty mappings are leaves
+func flatten(out map[string]any, prefix string, settings map[string]any) {
+	for k, v := range settings {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if m, ok := v.(map[string]any); ok && len(m) > 0 {
+			flatten(out, key, m)
+			continue
+		}
+		out[strings.ToLower(key)] = v
+	}
+}
@@ -0,0 +1,102 @@
+package snapshot
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/spf13/viper"
+
+	"github.com/vvfock3r/gooey/kernel/schema"
+)
+
+// Snapshot is an immutable view of the effective configuration,
+// a reload builds a new snapshot and swaps it in atomically
+type Snapshot struct {
+	version  uint64
+	settings map[string]any
+}
+
+var (
+	current atomic.Pointer[Snapshot]
+	version atomic.Uint64
+)
+
+// New builds a snapshot from nested settings, such as viper.AllSettings(), the settings are copied
+func New(settings map[string]any) *Snapshot {
+	return &Snapshot{settings: copyMap(settings)}
+}
+
+// Current returns the active snapshot, if none is stored yet it is built from viper
+func Current() *Snapshot {
+	s := current.Load()
+	if s == nil {
+		return New(viper.AllSettings())
+	}
+	return s
+}
+
+// Store makes s the active snapshot
+func Store(s *Snapshot) {
+	s.version = version.Add(1)
+	current.Store(s)
+}
+
+// Version returns the sequence number assigned by Store, 0 means the snapshot was never stored
+func (s *Snapshot) Version() uint64 {
+	return s.version
+}
+
+// Get returns a copy of the value of a dotted key, nil if the key does not exist
+func (s *Snapshot) Get(key string) any {
+	if key == "" {
+		return copyMap(s.settings)
+	}
+
+	var value any = s.settings
+	for _, part := range strings.Split(strings.ToLower(key), ".") {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value, ok = m[part]
+		if !ok {
+			return nil
+		}
+	}
+	return copyValue(value)
+}
+
+// AllSettings returns a copy of all settings
+func (s *Snapshot) AllSettings() map[string]any {
+	return copyMap(s.settings)
+}
+
+// Decode decodes the subtree of a dotted key into the struct pointed to by out
+func (s *Snapshot) Decode(key string, out any) error {
+	return schema.Decode(s.Get(key), out)
+}
+
+func copyMap(m map[string]any) map[string]any {
+	c := make(map[string]any, len(m))
+	for k, v := range m {
+		c[k] = copyValue(v)
+	}
+	return c
+}
+
+func copyValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		return copyMap(v)
+	case []any:
+		c := make([]any, len(v))
+		for i, item := range v {
+			c[i] = copyValue(item)
+		}
+		return c
+	case []string:
+		return append([]string(nil), v...)
+	default:
+		return v
+	}
+}